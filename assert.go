@@ -0,0 +1,192 @@
+package fakegopath
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// AssertImports fails tb if any of imports is not imported by some .go file in packageDir,
+// where packageDir is relative to the src directory. Test files, and files excluded by the build
+// constraints of BuildContext, are ignored.
+func (t *Temporary) AssertImports(tb testing.TB, packageDir string, imports ...string) {
+	tb.Helper()
+	dir := filepath.Join(t.Src, packageDir)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		tb.Fatalf("failed to read %s: %v", dir, err)
+	}
+	ctx := t.BuildContext()
+	fset := token.NewFileSet()
+	found := map[string]bool{}
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := ctx.MatchFile(dir, name); err != nil {
+			tb.Fatalf("failed to read %s: %v", name, err)
+		} else if !ok {
+			continue
+		}
+		file := filepath.Join(dir, name)
+		f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			tb.Fatalf("failed to parse %s: %v", file, err)
+		}
+		for _, imp := range f.Imports {
+			if p, err := strconv.Unquote(imp.Path.Value); err == nil {
+				found[p] = true
+			}
+		}
+	}
+	for _, imp := range imports {
+		if !found[imp] {
+			tb.Errorf("%s does not import %q", packageDir, imp)
+		}
+	}
+}
+
+// AssertFileEquals fails tb with a line diff if file, a path relative to the src directory, does not contain want.
+func (t *Temporary) AssertFileEquals(tb testing.TB, file string, want []byte) {
+	tb.Helper()
+	got, err := ioutil.ReadFile(filepath.Join(t.Src, file))
+	if err != nil {
+		tb.Fatalf("failed to read %s: %v", file, err)
+	}
+	if !bytes.Equal(got, want) {
+		tb.Errorf("%s differs from expected (-want +got):\n%s", file, lineDiff(string(want), string(got)))
+	}
+}
+
+// AssertNoArtifacts fails tb if the tree contains build artifacts: .a, .o or executable files, or any file in
+// the bin or pkg directories. Files whose path relative to Path matches one of the allow patterns are permitted.
+func (t *Temporary) AssertNoArtifacts(tb testing.TB, allow ...string) {
+	tb.Helper()
+	var outputDirs []string
+	for _, d := range []string{t.Bin, t.Pkg} {
+		if d != "" {
+			rel, err := filepath.Rel(t.Path, d)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			outputDirs = append(outputDirs, filepath.ToSlash(rel)+"/")
+		}
+	}
+	err := walkFiles(t.Path, func(rel string, info os.FileInfo) error {
+		for _, pattern := range allow {
+			if ok, _ := path.Match(pattern, rel); ok {
+				return nil
+			}
+		}
+		switch ext := path.Ext(rel); {
+		case ext == ".a" || ext == ".o":
+			tb.Errorf("%s: object file", rel)
+		case info.Mode()&0111 != 0:
+			tb.Errorf("%s: executable", rel)
+		default:
+			for _, d := range outputDirs {
+				if strings.HasPrefix(rel, d) {
+					tb.Errorf("%s: file in %s", rel, d)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// AssertTreesEqual fails tb, listing the differences, if the src directories of a and b are not byte-identical.
+// Files whose slash separated path matches one of the ignore patterns are not compared.
+func AssertTreesEqual(tb testing.TB, a, b *Temporary, ignore ...string) {
+	tb.Helper()
+	diffs, err := DiffTrees(a, b)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var msgs []string
+diffs:
+	for _, d := range diffs {
+		for _, pattern := range ignore {
+			if ok, _ := path.Match(pattern, d.Path); ok {
+				continue diffs
+			}
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %v", d.Path, d.Kind))
+	}
+	if len(msgs) > 0 {
+		tb.Errorf("trees differ:\n%s", strings.Join(msgs, "\n"))
+	}
+}
+
+// AssertResolves fails tb unless importPath, resolved by go list run with RunGo, is in a directory under expectDir.
+// It can be used to check that the tree takes precedence over other GOPATH entries.
+func (t *Temporary) AssertResolves(tb testing.TB, importPath, expectDir string) {
+	tb.Helper()
+	stdout, stderr, err := t.RunGo("list", "-f", "{{.Dir}}", importPath)
+	if err != nil {
+		tb.Fatalf("failed to resolve %s: %v\n%s", importPath, err, stderr)
+	}
+	resolved := strings.TrimSpace(stdout)
+	dir, want := resolved, expectDir
+	// Compare canonical paths, since GOPATH entries for trees have their symlinks resolved.
+	if d, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = d
+	}
+	if w, err := filepath.EvalSymlinks(want); err == nil {
+		want = w
+	}
+	if rel, err := filepath.Rel(want, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		tb.Errorf("%s resolved to %s, not under %s", importPath, resolved, expectDir)
+	}
+}
+
+// AssertRequires fails tb unless the go.mod in the module root requires modulePath.
+// If version is not empty, the required version must also match.
+func (t *Temporary) AssertRequires(tb testing.TB, modulePath, version string) {
+	tb.Helper()
+	reqs, err := goModRequires(filepath.Join(t.Src, "go.mod"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	got, ok := reqs[modulePath]
+	switch {
+	case !ok:
+		tb.Errorf("go.mod does not require %s", modulePath)
+	case version != "" && got != version:
+		tb.Errorf("go.mod requires %s %s, not %s", modulePath, got, version)
+	}
+}
+
+// AssertFileMatches fails tb if the regular expression pattern does not match anywhere in file,
+// a path relative to the src directory.
+func (t *Temporary) AssertFileMatches(tb testing.TB, file, pattern string) {
+	tb.Helper()
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		tb.Fatalf("invalid pattern %q: %v", pattern, err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(t.Src, file))
+	if err != nil {
+		tb.Fatalf("failed to read %s: %v", file, err)
+	}
+	if !re.Match(got) {
+		const maxSnippet = 200
+		snippet := string(got)
+		if len(snippet) > maxSnippet {
+			snippet = snippet[:maxSnippet] + "..."
+		}
+		tb.Errorf("%s does not match %q, starts with:\n%s", file, pattern, snippet)
+	}
+}
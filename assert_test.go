@@ -0,0 +1,241 @@
+package fakegopath
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// recordingTB records the failures reported through it instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	msgs []string
+}
+
+func (r *recordingTB) Helper()                                 {}
+func (r *recordingTB) Logf(format string, args ...interface{}) {}
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+func (r *recordingTB) Error(args ...interface{}) { r.msgs = append(r.msgs, fmt.Sprint(args...)) }
+func (r *recordingTB) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+func (r *recordingTB) Fatal(args ...interface{}) { r.Error(args...); runtime.Goexit() }
+func (r *recordingTB) Failed() bool              { return len(r.msgs) > 0 }
+func (r *recordingTB) String() string            { return strings.Join(r.msgs, "\n") }
+
+// record runs fn with a recordingTB on its own goroutine, so that a fatal failure only stops fn.
+func record(fn func(tb testing.TB)) *recordingTB {
+	r := &recordingTB{}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		fn(r)
+	}()
+	<-done
+	return r
+}
+
+func TestAssertImports(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"p/a.go":       []byte("package p\n\nimport \"fmt\"\n\nvar _ = fmt.Sprint\n"),
+		"p/b.go":       []byte("package p\n\nimport \"strings\"\n\nvar _ = strings.Repeat\n"),
+		"p/a_test.go":  []byte("package p_test\n\nimport \"os\"\n\nvar _ = os.Exit\n"),
+		"p/ignored.go": []byte("//go:build ignore\n\npackage p\n\nimport \"net\"\n\nvar _ = net.Dial\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+
+	if r := record(func(tb testing.TB) { tmp.AssertImports(tb, "p", "fmt", "strings") }); r.Failed() {
+		t.Errorf("imports across files were not found: %s", r)
+	}
+	r := record(func(tb testing.TB) { tmp.AssertImports(tb, "p", "fmt", "bytes", "os", "net") })
+	if len(r.msgs) != 3 {
+		t.Fatalf("got failures %q, want bytes, os and net reported missing", r.msgs)
+	}
+	for i, imp := range []string{"bytes", "os", "net"} {
+		if !strings.Contains(r.msgs[i], imp) {
+			t.Errorf("failure %q does not mention %s", r.msgs[i], imp)
+		}
+	}
+}
+
+func TestAssertFileEquals(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"p/p.go": []byte("package p\n\nconst X = 1\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if r := record(func(tb testing.TB) { tmp.AssertFileEquals(tb, "p/p.go", []byte("package p\n\nconst X = 1\n")) }); r.Failed() {
+		t.Errorf("matching file reported as different: %s", r)
+	}
+	r := record(func(tb testing.TB) { tmp.AssertFileEquals(tb, "p/p.go", []byte("package p\n\nconst X = 2\n")) })
+	if len(r.msgs) != 1 {
+		t.Fatalf("got failures %q, want one", r.msgs)
+	}
+	for _, want := range []string{"p/p.go", "  package p\n", "- const X = 2\n", "+ const X = 1\n"} {
+		if !strings.Contains(r.msgs[0], want) {
+			t.Errorf("failure %q does not contain %q", r.msgs[0], want)
+		}
+	}
+}
+
+func TestAssertNoArtifacts(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"p/p.go": []byte("package p\n")})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if r := record(func(tb testing.TB) { tmp.AssertNoArtifacts(tb) }); r.Failed() {
+		t.Errorf("source-only tree reported artifacts: %s", r)
+	}
+	if err := tmp.WriteFile(filepath.Join("p", "p.o"), strings.NewReader("object")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp.Bin, "tool"), []byte("binary"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := record(func(tb testing.TB) { tmp.AssertNoArtifacts(tb) })
+	if len(r.msgs) != 2 || !strings.Contains(r.String(), "src/p/p.o") || !strings.Contains(r.String(), "bin/tool") {
+		t.Errorf("got failures %q, want src/p/p.o and bin/tool reported", r.msgs)
+	}
+	if r := record(func(tb testing.TB) { tmp.AssertNoArtifacts(tb, "src/p/*.o", "bin/*") }); r.Failed() {
+		t.Errorf("allowed artifacts were reported: %s", r)
+	}
+}
+
+func TestAssertTreesEqual(t *testing.T) {
+	files := map[string][]byte{
+		"p/p.go":      []byte("package p\n"),
+		"p/README.md": []byte("p\n"),
+	}
+	a, err := NewTemporaryFromMap("fakegopath", files)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer a.Reset()
+	b, err := NewTemporaryFromMap("fakegopath", files)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer b.Reset()
+	if r := record(func(tb testing.TB) { AssertTreesEqual(tb, a, b) }); r.Failed() {
+		t.Errorf("identical trees reported as different:\n%s", r)
+	}
+
+	if err := b.WriteFile("p/README.md", strings.NewReader("changed\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteFile("p/extra.go", strings.NewReader("package p\n")); err != nil {
+		t.Fatal(err)
+	}
+	r := record(func(tb testing.TB) { AssertTreesEqual(tb, a, b) })
+	for _, want := range []string{"p/README.md: content differs", "p/extra.go: only in b"} {
+		if !strings.Contains(r.String(), want) {
+			t.Errorf("failure doesn't mention %q:\n%s", want, r)
+		}
+	}
+	if r := record(func(tb testing.TB) { AssertTreesEqual(tb, a, b, "*/*.md", "p/extra.go") }); r.Failed() {
+		t.Errorf("ignored differences reported:\n%s", r)
+	}
+	r = record(func(tb testing.TB) { AssertTreesEqual(tb, a, b, "*.md") })
+	if !strings.Contains(r.String(), "p/README.md") {
+		t.Errorf("*.md ignored p/README.md, patterns should match the whole slash separated path:\n%s", r)
+	}
+}
+
+func TestAssertResolves(t *testing.T) {
+	files := map[string][]byte{"dup/dup.go": []byte("package dup\n")}
+	older, err := NewTemporaryFromMap("fakegopath", files)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer older.Reset()
+	newer, err := NewTemporaryFromMap("fakegopath", files)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer newer.Reset()
+	// The newer tree comes first in GOPATH, so it wins for both trees.
+	for _, tmp := range []*Temporary{older, newer} {
+		if r := record(func(tb testing.TB) { tmp.AssertResolves(tb, "dup", newer.Src) }); r.Failed() {
+			t.Errorf("dup didn't resolve to the newer tree:\n%s", r)
+		}
+		r := record(func(tb testing.TB) { tmp.AssertResolves(tb, "dup", older.Src) })
+		if !strings.Contains(r.String(), "not under "+older.Src) {
+			t.Errorf("resolving to the older tree, got:\n%s", r)
+		}
+	}
+	if r := record(func(tb testing.TB) { newer.AssertResolves(tb, "missing/pkg", newer.Src) }); !r.Failed() {
+		t.Error("missing package resolved")
+	}
+}
+
+func TestAssertRequires(t *testing.T) {
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	gomod := "module example.com/m\n\nrequire example.com/single v1.0.0\n\nrequire (\n\texample.com/a v1.2.3\n\texample.com/b v0.1.0 // indirect\n)\n"
+	if err := tmp.WriteFile("go.mod", strings.NewReader(gomod)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ module, version string }{
+		{"example.com/single", ""},
+		{"example.com/single", "v1.0.0"},
+		{"example.com/a", "v1.2.3"},
+		{"example.com/b", ""},
+		{"example.com/b", "v0.1.0"},
+	} {
+		if r := record(func(tb testing.TB) { tmp.AssertRequires(tb, c.module, c.version) }); r.Failed() {
+			t.Errorf("AssertRequires(%s, %q) failed:\n%s", c.module, c.version, r)
+		}
+	}
+	for _, c := range []struct{ module, version, msg string }{
+		{"example.com/missing", "", "does not require example.com/missing"},
+		{"example.com/a", "v1.0.0", "requires example.com/a v1.2.3, not v1.0.0"},
+		{"example.com/single", "v2.0.0", "requires example.com/single v1.0.0, not v2.0.0"},
+	} {
+		r := record(func(tb testing.TB) { tmp.AssertRequires(tb, c.module, c.version) })
+		if !strings.Contains(r.String(), c.msg) {
+			t.Errorf("AssertRequires(%s, %q) = %q, want %q", c.module, c.version, r, c.msg)
+		}
+	}
+}
+
+func TestAssertFileMatches(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"p/p.go":   []byte("package p\n\nconst Version = \"v1.2.3\"\n"),
+		"long.txt": []byte(strings.Repeat("x", 300)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if r := record(func(tb testing.TB) { tmp.AssertFileMatches(tb, "p/p.go", `Version = "v\d+\.\d+\.\d+"`) }); r.Failed() {
+		t.Errorf("matching pattern failed:\n%s", r)
+	}
+	r := record(func(tb testing.TB) { tmp.AssertFileMatches(tb, "p/p.go", `Version = "v2`) })
+	for _, want := range []string{"p/p.go", `Version = \"v2`, "package p\n"} {
+		if !strings.Contains(r.String(), want) {
+			t.Errorf("failure doesn't contain %q:\n%s", want, r)
+		}
+	}
+	r = record(func(tb testing.TB) { tmp.AssertFileMatches(tb, "long.txt", "y") })
+	if !strings.Contains(r.String(), strings.Repeat("x", 200)+"...") || strings.Contains(r.String(), strings.Repeat("x", 201)) {
+		t.Errorf("long file not truncated to 200 bytes:\n%s", r)
+	}
+	if r := record(func(tb testing.TB) { tmp.AssertFileMatches(tb, "p/p.go", "(") }); !strings.Contains(r.String(), "invalid pattern") {
+		t.Errorf("invalid pattern, got:\n%s", r)
+	}
+}
@@ -0,0 +1,108 @@
+package fakegopath
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// TrackChanges runs fn and reports the files in the src directory that it created, modified and deleted,
+// as sorted, slash separated paths. err is the error from fn, or from reading the tree.
+func (t *Temporary) TrackChanges(fn func() error) (created, modified, deleted []string, err error) {
+	before, err := t.hashTree()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fnErr := fn()
+	after, err := t.hashTree()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for p, h := range after {
+		if b, ok := before[p]; !ok {
+			created = append(created, p)
+		} else if b != h {
+			modified = append(modified, p)
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			deleted = append(deleted, p)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(modified)
+	sort.Strings(deleted)
+	return created, modified, deleted, fnErr
+}
+
+func (t *Temporary) hashTree() (map[string][sha256.Size]byte, error) {
+	files, err := readTree(t.Src)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string][sha256.Size]byte, len(files))
+	for p, c := range files {
+		hashes[p] = sha256.Sum256(c)
+	}
+	return hashes, nil
+}
+
+// Checkpoint records the files in the src directory and their contents at a point in time. See RevertTo.
+type Checkpoint struct {
+	files map[string][]byte
+}
+
+// Checkpoint records the current files in the src directory.
+func (t *Temporary) Checkpoint() (*Checkpoint, error) {
+	files, err := t.ToMap()
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{files: files}, nil
+}
+
+// RevertTo restores the src directory to the files recorded by cp, deleting files created since,
+// and rewriting files that were changed or deleted. Files that are unchanged are left alone.
+func (t *Temporary) RevertTo(cp *Checkpoint) error {
+	current, err := t.ToMap()
+	if err != nil {
+		return err
+	}
+	for p := range current {
+		if _, ok := cp.files[p]; !ok {
+			file := filepath.Join(t.Src, filepath.FromSlash(p))
+			if err := os.Remove(file); err != nil {
+				return fmt.Errorf("failed to remove %s: %v", file, err)
+			}
+			t.used -= int64(len(current[p]))
+		}
+	}
+	for p, c := range cp.files {
+		if cur, ok := current[p]; ok && bytes.Equal(cur, c) {
+			continue
+		}
+		// Write directly rather than with WriteFile, so that options such as WithForceCRLF don't change the contents.
+		file := filepath.Join(t.Src, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return fmt.Errorf("failed to create dir %s: %v", filepath.Dir(file), err)
+		}
+		old := int64(len(current[p]))
+		if err := t.reserve(old, int64(len(c))); err != nil {
+			return err
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			t.used -= int64(len(c)) - old
+			return fmt.Errorf("failed to remove %s: %v", file, err)
+		}
+		if err := ioutil.WriteFile(file, c, 0600); err != nil {
+			t.used -= int64(len(c)) - fileSize(file)
+			return fmt.Errorf("failed to write %s: %v", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package fakegopath
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTrackChanges(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"gen/gen.go":   []byte("package gen\n\n//go:generate sh -c \"echo package gen > a_gen.go && mkdir -p sub && touch sub/b.txt && echo changed > keep.txt && rm old.txt\"\n"),
+		"gen/keep.txt": []byte("keep\n"),
+		"gen/old.txt":  []byte("old\n"),
+		"gen/same.txt": []byte("same\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	created, modified, deleted, err := tmp.TrackChanges(func() error {
+		if _, stderr, err := tmp.Generate("./gen"); err != nil {
+			return errors.New(stderr)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TrackChanges failed: %v", err)
+	}
+	if want := []string{"gen/a_gen.go", "gen/sub/b.txt"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("created = %v, want %v", created, want)
+	}
+	if want := []string{"gen/keep.txt"}; !reflect.DeepEqual(modified, want) {
+		t.Errorf("modified = %v, want %v", modified, want)
+	}
+	if want := []string{"gen/old.txt"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted = %v, want %v", deleted, want)
+	}
+
+	fnErr := errors.New("generator failed")
+	if _, _, _, err := tmp.TrackChanges(func() error { return fnErr }); err != fnErr {
+		t.Errorf("TrackChanges returned %v, want the error from fn", err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"p/p.go":     []byte("package p\n"),
+		"p/same.go":  []byte("package p\n"),
+		"p/gone.txt": []byte("gone\n"),
+	}, WithForceCRLF(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	cp, err := tmp.Checkpoint()
+	if err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if err := tmp.WriteFile("p/p.go", strings.NewReader("package p // changed\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmp.WriteFile("q/new.go", strings.NewReader("package q\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tmp.Src, "p", "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	sameInfo, err := os.Stat(filepath.Join(tmp.Src, "p", "same.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmp.RevertTo(cp); err != nil {
+		t.Fatalf("RevertTo failed: %v", err)
+	}
+	got, err := tmp.ToMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files are restored byte for byte, without being converted again.
+	want := map[string][]byte{
+		"p/p.go":     []byte("package p\r\n"),
+		"p/same.go":  []byte("package p\r\n"),
+		"p/gone.txt": []byte("gone\r\n"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reverted tree = %q, want %q", got, want)
+	}
+	if info, err := os.Stat(filepath.Join(tmp.Src, "p", "same.go")); err != nil || !os.SameFile(info, sameInfo) {
+		t.Errorf("unchanged file was rewritten: %v", err)
+	}
+}
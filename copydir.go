@@ -0,0 +1,103 @@
+package fakegopath
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WithMaxImportSize makes CopyDir skip files larger than n bytes, logging each skipped file.
+// If n is zero, files of any size are copied.
+func WithMaxImportSize(n int64) Option {
+	return func(t *Temporary) error {
+		t.maxImport = n
+		return nil
+	}
+}
+
+// WithSkipTestFiles makes CopyDir skip *_test.go files, e.g. when importing a package only to depend on it.
+func WithSkipTestFiles(skip bool) Option {
+	return func(t *Temporary) error {
+		t.skipTests = skip
+		return nil
+	}
+}
+
+// WithLowercaseNames makes CopyDir lowercase the names of the files it copies, failing if two files in the
+// same directory would then collide. This reproduces the behaviour of case-insensitive file systems.
+func WithLowercaseNames(enable bool) Option {
+	return func(t *Temporary) error {
+		t.lowercase = enable
+		return nil
+	}
+}
+
+// CopyDir copies every file under the directory src into dest, a path relative to the src directory.
+func (t *Temporary) CopyDir(dest, src string) error {
+	dirs := dirCache{}
+	lowered := map[string]string{} // Maps lowercased paths to the paths they were copied from.
+	return walkFilesOrdered(src, t.less, func(rel string, info os.FileInfo) error {
+		if t.skipTests && strings.HasSuffix(rel, "_test.go") {
+			return nil
+		}
+		from := filepath.Join(src, filepath.FromSlash(rel))
+		if t.maxImport > 0 && info.Size() > t.maxImport {
+			log.Printf("skipping %s: size %d exceeds %d", from, info.Size(), t.maxImport)
+			return nil
+		}
+		to := rel
+		if t.lowercase {
+			to = path.Join(path.Dir(rel), strings.ToLower(path.Base(rel)))
+			if prev, ok := lowered[to]; ok {
+				return fmt.Errorf("%s and %s both copy to %s when lowercased", prev, rel, to)
+			}
+			lowered[to] = rel
+		}
+		return t.copyFile(filepath.Join(dest, filepath.FromSlash(to)), from, dirs)
+	})
+}
+
+// CopyDirs copies each of roots into dest in order, using CopyDir. Files in later roots
+// overwrite files at the same path from earlier roots.
+func (t *Temporary) CopyDirs(dest string, roots ...string) error {
+	for _, r := range roots {
+		if err := t.CopyDir(dest, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyPackage copies the .go files in srcDir whose package clause names pkgName into dest, a path
+// relative to the src directory. Files belonging to other packages, including pkgName_test, are ignored.
+func (t *Temporary) CopyPackage(dest, srcDir, pkgName string) error {
+	infos, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", srcDir, err)
+	}
+	dirs := dirCache{}
+	fset := token.NewFileSet()
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || filepath.Ext(info.Name()) != ".go" {
+			continue
+		}
+		file := filepath.Join(srcDir, info.Name())
+		f, err := parser.ParseFile(fset, file, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", file, err)
+		}
+		if f.Name.Name != pkgName {
+			continue
+		}
+		if err := t.copyFile(filepath.Join(dest, info.Name()), file, dirs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
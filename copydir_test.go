@@ -0,0 +1,154 @@
+package fakegopath
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeDir creates files, keyed by slash separated path, under a new temporary directory and returns it.
+func writeDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for p, c := range files {
+		file := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatalf("failed to create dir for %s: %v", p, err)
+		}
+		if err := ioutil.WriteFile(file, []byte(c), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", p, err)
+		}
+	}
+	return dir
+}
+
+func TestWithMaxImportSize(t *testing.T) {
+	src := writeDir(t, map[string]string{
+		"p/p.go":      "package p\n",
+		"p/asset.bin": strings.Repeat("x", 1024),
+	})
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithMaxImportSize(100))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.CopyDir("dep", src); err != nil {
+		t.Fatalf("CopyDir failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp.Src, "dep", "p", "p.go")); err != nil {
+		t.Errorf("small file was not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp.Src, "dep", "p", "asset.bin")); !os.IsNotExist(err) {
+		t.Errorf("oversized file was copied: %v", err)
+	}
+	if !strings.Contains(logged.String(), "asset.bin") {
+		t.Errorf("skipped file was not logged: %q", logged.String())
+	}
+}
+
+func TestCopyDirs(t *testing.T) {
+	base := writeDir(t, map[string]string{"p/p.go": "package p // base\n", "p/base.go": "package p\n"})
+	override := writeDir(t, map[string]string{"p/p.go": "package p // override\n"})
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.CopyDirs("dest", base, override); err != nil {
+		t.Fatalf("CopyDirs failed: %v", err)
+	}
+	got, err := tmp.ToMap()
+	if err != nil {
+		t.Fatalf("ToMap failed: %v", err)
+	}
+	want := map[string][]byte{
+		"dest/p/p.go":    []byte("package p // override\n"),
+		"dest/p/base.go": []byte("package p\n"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %q, want %q", got, want)
+	}
+}
+
+func TestCopyPackage(t *testing.T) {
+	src := writeDir(t, map[string]string{
+		"a.go":      "package a\n",
+		"a2.go":     "// Comments before the clause are fine.\npackage a\n",
+		"a_test.go": "package a_test\n",
+		"b.go":      "package b\n",
+		"notes.txt": "package a\n",
+	})
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.CopyPackage("a", src, "a"); err != nil {
+		t.Fatalf("CopyPackage failed: %v", err)
+	}
+	files, err := tmp.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/a.go", "a/a2.go"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("copied %q, want %q", files, want)
+	}
+}
+
+func TestWithSkipTestFiles(t *testing.T) {
+	src := writeDir(t, map[string]string{
+		"p/p.go":      "package p\n\nfunc P() {}\n",
+		"p/p_test.go": "package p\n\nimport \"missing/dependency\"\n",
+		"p/x_test.go": "package p_test\n",
+	})
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithSkipTestFiles(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.CopyDir("dep", src); err != nil {
+		t.Fatalf("CopyDir failed: %v", err)
+	}
+	files, err := tmp.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dep/p/p.go"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Files = %v, want %v", files, want)
+	}
+	if _, stderr, err := tmp.RunGo("vet", "dep/p"); err != nil {
+		t.Errorf("package without its tests doesn't build: %v\n%s", err, stderr)
+	}
+}
+
+func TestWithLowercaseNames(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithLowercaseNames(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.CopyDir("ok", writeDir(t, map[string]string{"P/Main.go": "package p\n", "P/util.go": "package p\n"})); err != nil {
+		t.Fatalf("CopyDir failed: %v", err)
+	}
+	files, err := tmp.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only file names are lowercased, not directories.
+	if want := []string{"ok/P/main.go", "ok/P/util.go"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Files = %v, want %v", files, want)
+	}
+	err = tmp.CopyDir("clash", writeDir(t, map[string]string{"p/Foo.go": "package p\n", "p/foo.go": "package p\n"}))
+	if err == nil || !strings.Contains(err.Error(), "p/Foo.go and p/foo.go both copy to p/foo.go") {
+		t.Errorf("CopyDir with colliding names = %v, want a collision error", err)
+	}
+}
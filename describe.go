@@ -0,0 +1,48 @@
+package fakegopath
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// describedEnv lists the environment variables reported by Describe.
+var describedEnv = []string{"GO111MODULE", "GOPATH", "GOFLAGS", "GOPROXY", "GOSUMDB", "GOPRIVATE", "GONOSUMDB", "GOMODCACHE", "CGO_ENABLED"}
+
+// Describe returns a multi-line description of the tree's layout for debugging: its mode, GOPATH entries,
+// module path and root, and the Go environment variables set by Env.
+func (t *Temporary) Describe() string {
+	buf := bytes.NewBuffer([]byte{})
+	if t.IsModule() {
+		fmt.Fprintf(buf, "mode: module\nmodule: %s\nroot: %s\n", t.module, t.Src)
+		roots := make([]string, 0, len(t.nested))
+		for r := range t.nested {
+			roots = append(roots, r)
+		}
+		sort.Strings(roots)
+		for _, r := range roots {
+			fmt.Fprintf(buf, "nested module: %s at %s\n", t.nested[r], filepath.Join(t.Src, filepath.FromSlash(r)))
+		}
+	} else {
+		fmt.Fprintf(buf, "mode: GOPATH\nsrc: %s\nupdates global GOPATH: %v\n", t.Src, t.update)
+	}
+	fmt.Fprintln(buf, "GOPATH entries:")
+	for _, p := range filepath.SplitList(t.BuildContext().GOPATH) {
+		fmt.Fprintf(buf, "  %s\n", p)
+	}
+	env := map[string]string{}
+	for _, e := range t.Env() {
+		if kv := strings.SplitN(e, "=", 2); len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	fmt.Fprintln(buf, "env:")
+	for _, k := range describedEnv {
+		if v, ok := env[k]; ok {
+			fmt.Fprintf(buf, "  %s=%s\n", k, v)
+		}
+	}
+	return buf.String()
+}
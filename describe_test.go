@@ -0,0 +1,42 @@
+package fakegopath
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	gopath, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer gopath.Reset()
+	desc := gopath.Describe()
+	for _, want := range []string{"mode: GOPATH\n", "src: " + gopath.Src + "\n", "  " + gopath.canonical + "\n", "  GO111MODULE=off\n"} {
+		if !strings.Contains(desc, want) {
+			t.Errorf("GOPATH description doesn't contain %q:\n%s", want, desc)
+		}
+	}
+
+	mod, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer mod.Reset()
+	if err := mod.AddNestedModule("tools", "example.com/tools", ""); err != nil {
+		t.Fatal(err)
+	}
+	desc = mod.Describe()
+	for _, want := range []string{
+		"mode: module\n",
+		"module: example.com/m\n",
+		"root: " + mod.Src + "\n",
+		"nested module: example.com/tools at " + filepath.Join(mod.Src, "tools") + "\n",
+		"  GO111MODULE=on\n",
+	} {
+		if !strings.Contains(desc, want) {
+			t.Errorf("module description doesn't contain %q:\n%s", want, desc)
+		}
+	}
+}
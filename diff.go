@@ -0,0 +1,125 @@
+package fakegopath
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// DiffKind describes how a file differs between two trees.
+type DiffKind int
+
+const (
+	OnlyInA        DiffKind = iota // The file exists only in the first tree.
+	OnlyInB                        // The file exists only in the second tree.
+	ContentDiffers                 // The file exists in both trees with different content.
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case OnlyInA:
+		return "only in a"
+	case OnlyInB:
+		return "only in b"
+	case ContentDiffers:
+		return "content differs"
+	}
+	return "unknown"
+}
+
+// Difference is a single file that differs between two trees.
+type Difference struct {
+	Path string // The slash separated path relative to the src directory.
+	Kind DiffKind
+}
+
+// DiffTrees compares the src directories of a and b, returning the differences sorted by path.
+func DiffTrees(a, b *Temporary) ([]Difference, error) {
+	return diffDirs(a.Src, b.Src)
+}
+
+func diffDirs(a, b string) ([]Difference, error) {
+	filesA, err := readTree(a)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := readTree(b)
+	if err != nil {
+		return nil, err
+	}
+	return diffFiles(filesA, filesB), nil
+}
+
+func diffFiles(a, b map[string][]byte) []Difference {
+	var diffs []Difference
+	for p, ca := range a {
+		cb, ok := b[p]
+		switch {
+		case !ok:
+			diffs = append(diffs, Difference{Path: p, Kind: OnlyInA})
+		case !bytes.Equal(ca, cb):
+			diffs = append(diffs, Difference{Path: p, Kind: ContentDiffers})
+		}
+	}
+	for p := range b {
+		if _, ok := a[p]; !ok {
+			diffs = append(diffs, Difference{Path: p, Kind: OnlyInB})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs
+}
+
+// lineDiff returns a line by line diff of want and got, with removed lines prefixed by "-" and added lines by "+".
+func lineDiff(want, got string) string {
+	a, b := splitLines(want), splitLines(got)
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	buf := bytes.NewBuffer([]byte{})
+	line := func(prefix, l string) {
+		buf.WriteString(prefix + strings.TrimSuffix(l, "\n") + "\n")
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			line("  ", a[i])
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			line("- ", a[i])
+			i++
+		default:
+			line("+ ", b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		line("- ", a[i])
+	}
+	for ; j < len(b); j++ {
+		line("+ ", b[j])
+	}
+	return buf.String()
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
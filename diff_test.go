@@ -0,0 +1,44 @@
+package fakegopath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTrees(t *testing.T) {
+	a, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"p/same.go":    []byte("package p\n"),
+		"p/changed.go": []byte("package p\n\nvar X = 1\n"),
+		"p/onlya.go":   []byte("package p\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer a.Reset()
+	b, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"p/same.go":    []byte("package p\n"),
+		"p/changed.go": []byte("package p\n\nvar X = 2\n"),
+		"p/onlyb.go":   []byte("package p\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer b.Reset()
+
+	diffs, err := DiffTrees(a, b)
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+	want := []Difference{
+		{Path: "p/changed.go", Kind: ContentDiffers},
+		{Path: "p/onlya.go", Kind: OnlyInA},
+		{Path: "p/onlyb.go", Kind: OnlyInB},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("DiffTrees = %v, want %v", diffs, want)
+	}
+
+	if diffs, err := DiffTrees(a, a); err != nil || len(diffs) != 0 {
+		t.Errorf("DiffTrees of a tree with itself = %v, %v, want no differences", diffs, err)
+	}
+}
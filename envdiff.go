@@ -0,0 +1,54 @@
+package fakegopath
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvChange is a change to a single environment variable. Before or After is empty if the
+// variable was unset.
+type EnvChange struct {
+	Key    string
+	Before string
+	After  string
+}
+
+// EnvDiff returns the variables that differ between before and after, sorted by key.
+func EnvDiff(before, after map[string]string) []EnvChange {
+	var changes []EnvChange
+	for k, b := range before {
+		if a, ok := after[k]; !ok || a != b {
+			changes = append(changes, EnvChange{Key: k, Before: b, After: a})
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			changes = append(changes, EnvChange{Key: k, After: a})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// TrackEnv runs fn and returns the changes it made to Go related environment variables,
+// those starting with GO or CGO_.
+func TrackEnv(fn func() error) ([]EnvChange, error) {
+	before := goEnv()
+	err := fn()
+	return EnvDiff(before, goEnv()), err
+}
+
+func goEnv() map[string]string {
+	env := map[string]string{}
+	for _, e := range os.Environ() {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 && isGoVar(kv[0]) {
+			env[kv[0]] = kv[1]
+		}
+	}
+	return env
+}
+
+// isGoVar returns whether key is a Go related environment variable.
+func isGoVar(key string) bool { return strings.HasPrefix(key, "GO") || strings.HasPrefix(key, "CGO_") }
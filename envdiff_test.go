@@ -0,0 +1,36 @@
+package fakegopath
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTrackEnv(t *testing.T) {
+	orig := os.Getenv("GOPATH")
+	var tmp *Temporary
+	changes, err := TrackEnv(func() error {
+		var err error
+		tmp, err = NewTemporary(t.TempDir(), true)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if len(changes) != 1 || changes[0].Key != "GOPATH" || changes[0].Before != orig || changes[0].After != os.Getenv("GOPATH") {
+		t.Errorf("changes = %+v, want only GOPATH changed from %s", changes, orig)
+	}
+}
+
+func TestEnvDiff(t *testing.T) {
+	changes := EnvDiff(map[string]string{"A": "1", "B": "2"}, map[string]string{"B": "3", "C": "4"})
+	want := []EnvChange{{Key: "A", Before: "1"}, {Key: "B", Before: "2", After: "3"}, {Key: "C", After: "4"}}
+	if len(changes) != len(want) {
+		t.Fatalf("EnvDiff = %+v, want %+v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package fakegopath
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Env returns the environment for running commands against the tree.
+// It is the current process environment, or the base set by WithCleanEnv, with GOPATH set to include
+// the tree, or module mode enabled for module-style trees, along with any variables set by options
+// such as WithDeterministicBuild.
+func (t *Temporary) Env() []string {
+	env, pathEnv := os.Environ(), os.Getenv("PATH")
+	if t.cleanEnv != nil {
+		env, pathEnv = t.baseEnv(), t.cleanEnv["PATH"]
+	}
+	if t.IsModule() {
+		env = setEnv(env, "GO111MODULE", "on")
+	} else {
+		env = setEnv(env, "GOPATH", t.goPath())
+		env = setEnv(env, "GO111MODULE", "off")
+	}
+	if len(t.path) > 0 {
+		env = setEnv(env, "PATH", joinList(append(append([]string{}, t.path...), pathEnv)...))
+	}
+	keys := make([]string, 0, len(t.vars))
+	for k := range t.vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = setEnv(env, k, t.vars[k])
+	}
+	return env
+}
+
+// RunGo runs the go tool with args in the src directory (the module root for module-style trees), using the environment returned by Env.
+func (t *Temporary) RunGo(args ...string) (stdout, stderr string, err error) {
+	return t.RunGoIn("", args...)
+}
+
+// RunGoIn is like RunGo, but runs the go tool in dir, a path relative to the src directory.
+// It can be used to build a nested module added by AddNestedModule.
+func (t *Temporary) RunGoIn(dir string, args ...string) (stdout, stderr string, err error) {
+	stdout, stderr, err = t.run(filepath.Join(t.Src, dir), "go", args)
+	t.logGo(args, stdout+stderr)
+	return stdout, stderr, err
+}
+
+// commandLog holds the go commands run against a tree and their output. It is locked since shared
+// trees from FreezeShared are used from several goroutines.
+type commandLog struct {
+	sync.Mutex
+	entries []string
+}
+
+func (l *commandLog) String() string {
+	l.Lock()
+	defer l.Unlock()
+	return strings.Join(l.entries, "\n")
+}
+
+// logGo records a go command run against the tree, and its output, for SaveReproducer.
+func (t *Temporary) logGo(args []string, output string) {
+	t.goLog.Lock()
+	defer t.goLog.Unlock()
+	t.goLog.entries = append(t.goLog.entries, fmt.Sprintf("$ go %s\n%s", strings.Join(args, " "), output))
+}
+
+// StreamGo runs the go tool with args like RunGo, calling onLine with each line of its combined
+// stdout and stderr as it is produced. It returns once the command has finished.
+func (t *Temporary) StreamGo(args []string, onLine func(line string)) error {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = t.Src
+	cmd.Env = t.Env()
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("go %s failed: %v", strings.Join(args, " "), err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		logError("failed to close pipe", pw.Close())
+		done <- err
+	}()
+	output := bytes.NewBuffer([]byte{})
+	defer func() { t.logGo(args, output.String()) }()
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		output.WriteString(scanner.Text() + "\n")
+		onLine(scanner.Text())
+	}
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		// Drain the pipe so that the command isn't blocked writing to it.
+		_, _ = io.Copy(ioutil.Discard, pr)
+	}
+	if err := <-done; err != nil {
+		return fmt.Errorf("go %s failed: %v", strings.Join(args, " "), err)
+	}
+	if scanErr != nil {
+		return fmt.Errorf("failed to read output of go %s: %v", strings.Join(args, " "), scanErr)
+	}
+	return nil
+}
+
+// ListJSON runs go list -json over the packages matching pattern and returns its output,
+// a sequence of JSON objects, one per package.
+func (t *Temporary) ListJSON(pattern string) ([]byte, error) {
+	stdout, stderr, err := t.RunGo("list", "-json", pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, stderr)
+	}
+	return []byte(stdout), nil
+}
+
+// Run runs the program name with args in the src directory, using the environment returned by Env.
+// name is looked up in the PATH of Env, which starts with the directories added by AddToPath.
+func (t *Temporary) Run(name string, args ...string) (stdout, stderr string, err error) {
+	bin, err := t.lookPath(name)
+	if err != nil {
+		return "", "", err
+	}
+	return t.run(t.Src, bin, args)
+}
+
+func (t *Temporary) run(dir, bin string, args []string) (stdout, stderr string, err error) {
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	cmd.Env = t.Env()
+	outBuf, errBuf := bytes.NewBuffer([]byte{}), bytes.NewBuffer([]byte{})
+	cmd.Stdout, cmd.Stderr = outBuf, errBuf
+	if err := cmd.Run(); err != nil {
+		return outBuf.String(), errBuf.String(), fmt.Errorf("%s %s failed: %v", filepath.Base(bin), strings.Join(args, " "), err)
+	}
+	return outBuf.String(), errBuf.String(), nil
+}
+
+// lookPath finds name in the PATH of Env, which includes the directories added by AddToPath,
+// so that it resolves to the same program as a subprocess would.
+func (t *Temporary) lookPath(name string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) {
+		return name, nil
+	}
+	pathEnv := ""
+	for _, e := range t.Env() {
+		if strings.HasPrefix(e, "PATH=") {
+			pathEnv = strings.TrimPrefix(e, "PATH=")
+		}
+	}
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			continue
+		}
+		bin := filepath.Join(dir, name)
+		if info, err := os.Stat(bin); err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return bin, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %v", name, exec.ErrNotFound)
+}
+
+// Generate runs go generate over the packages matching pkgPattern, e.g. "./...".
+func (t *Temporary) Generate(pkgPattern string) (stdout, stderr string, err error) {
+	return t.RunGo("generate", pkgPattern)
+}
+
+// WithCleanEnv makes Env start from base instead of the current process environment, so that
+// commands are isolated from the caller's shell. HOME and PATH are taken from the process
+// environment unless base sets them, and the tree's Go variables are added as usual.
+func WithCleanEnv(base map[string]string) Option {
+	return func(t *Temporary) error {
+		t.cleanEnv = map[string]string{}
+		for _, k := range []string{"HOME", "PATH"} {
+			if v, ok := os.LookupEnv(k); ok {
+				t.cleanEnv[k] = v
+			}
+		}
+		for k, v := range base {
+			t.cleanEnv[k] = v
+		}
+		return nil
+	}
+}
+
+func (t *Temporary) baseEnv() []string {
+	env := make([]string, 0, len(t.cleanEnv))
+	for k, v := range t.cleanEnv {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// WithDeterministicBuild sets GOFLAGS and CGO_ENABLED in Env so that builds do not depend on
+// the machine or the VCS state of the tree. The variables are cleared on Reset.
+func WithDeterministicBuild() Option {
+	return func(t *Temporary) error {
+		t.setVar("GOFLAGS", "-trimpath -buildvcs=false")
+		t.setVar("CGO_ENABLED", "0")
+		return nil
+	}
+}
+
+// WithGoPrivate sets GOPRIVATE and GONOSUMDB in Env to patterns, a list of module path glob patterns,
+// so that matching modules bypass the module proxy and checksum database. The variables are cleared on Reset.
+func WithGoPrivate(patterns ...string) Option {
+	return func(t *Temporary) error {
+		p := strings.Join(patterns, ",")
+		t.setVar("GOPRIVATE", p)
+		t.setVar("GONOSUMDB", p)
+		return nil
+	}
+}
+
+func (t *Temporary) setVar(key, value string) {
+	if t.vars == nil {
+		t.vars = map[string]string{}
+	}
+	t.vars[key] = value
+}
+
+// StubGo writes script as an executable named go into the bin directory and prefixes bin to PATH in Env.
+// Tools run with Env that invoke go will run the stub instead. RunGo is unaffected.
+// PATH is restored on Reset.
+func (t *Temporary) StubGo(script string) error {
+	if t.shared {
+		return fmt.Errorf("cannot stub go in shared tree %s", t.Path)
+	}
+	stub := filepath.Join(t.Bin, "go")
+	if err := ioutil.WriteFile(stub, []byte(script), 0700); err != nil {
+		return fmt.Errorf("failed to write %s: %v", stub, err)
+	}
+	t.AddToPath(t.Bin)
+	return nil
+}
+
+// AddToPath prefixes dirs to PATH in Env, in the order given, so that programs in them are found
+// by Run and by subprocesses. PATH is restored on Reset.
+func (t *Temporary) AddToPath(dirs ...string) {
+	t.path = append(append([]string{}, dirs...), t.path...)
+}
+
+// setEnv returns env with key set to value, replacing any existing entry.
+func setEnv(env []string, key, value string) []string {
+	prefix := key + "="
+	res := make([]string, 0, len(env)+1)
+	for _, e := range env {
+		if !strings.HasPrefix(e, prefix) {
+			res = append(res, e)
+		}
+	}
+	return append(res, prefix+value)
+}
+
+// CopyThrough is equivalent to WriteFile with the output of command run with the contents of src as its input.
+// command[0] is looked up as for Run, and the command is run in the src directory using Env.
+func (t *Temporary) CopyThrough(dest, src string, command []string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("no command to copy %s through", src)
+	}
+	bin, err := t.lookPath(command[0])
+	if err != nil {
+		return err
+	}
+	input, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", src, err)
+	}
+	defer loggedClose(src, input)
+	cmd := exec.Command(bin, command[1:]...)
+	cmd.Dir = t.Src
+	cmd.Env = t.Env()
+	cmd.Stdin = input
+	outBuf, errBuf := bytes.NewBuffer([]byte{}), bytes.NewBuffer([]byte{})
+	cmd.Stdout, cmd.Stderr = outBuf, errBuf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed for %s: %v\n%s", strings.Join(command, " "), src, err, errBuf)
+	}
+	return t.WriteFile(dest, outBuf)
+}
@@ -0,0 +1,309 @@
+package fakegopath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerate(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"gen/gen.go": []byte("package gen\n\n//go:generate touch generated.txt\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if _, stderr, err := tmp.Generate("./..."); err != nil {
+		t.Fatalf("Generate failed: %v\n%s", err, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(tmp.Src, "gen", "generated.txt")); err != nil {
+		t.Errorf("go generate didn't create the file: %v", err)
+	}
+}
+
+func TestStubGo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub is a shell script")
+	}
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	calls := filepath.Join(tmp.Path, "calls")
+	if err := tmp.StubGo(fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\n", calls)); err != nil {
+		t.Fatalf("StubGo failed: %v", err)
+	}
+	// A tool under test that invokes go finds the stub on PATH.
+	if _, stderr, err := tmp.Run("sh", "-c", "go build ./..."); err != nil {
+		t.Fatalf("tool failed: %v\n%s", err, stderr)
+	}
+	b, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatalf("stub was not run: %v", err)
+	}
+	if got, want := string(b), "build ./...\n"; got != want {
+		t.Errorf("stub recorded %q, want %q", got, want)
+	}
+	tmp.Reset()
+	for _, e := range tmp.Env() {
+		if strings.HasPrefix(e, "PATH=") && strings.Contains(e, tmp.Bin) {
+			t.Errorf("PATH still contains %s after Reset: %s", tmp.Bin, e)
+		}
+	}
+}
+
+func TestWithDeterministicBuild(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"app/main.go": []byte("package main\n\nfunc main() {}\n"),
+	}, WithDeterministicBuild())
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	env := strings.Join(tmp.Env(), "\n")
+	for _, want := range []string{"GOFLAGS=-trimpath -buildvcs=false", "CGO_ENABLED=0"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("Env is missing %s", want)
+		}
+	}
+	var builds [][]byte
+	for i := 0; i < 2; i++ {
+		out := filepath.Join(tmp.Bin, fmt.Sprintf("app%d", i))
+		if _, stderr, err := tmp.RunGo("build", "-o", out, "app"); err != nil {
+			t.Fatalf("build failed: %v\n%s", err, stderr)
+		}
+		b, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatalf("failed to read binary: %v", err)
+		}
+		builds = append(builds, b)
+	}
+	if !bytes.Equal(builds[0], builds[1]) {
+		t.Error("two builds of the same package differ")
+	}
+	tmp.Reset()
+	if env := strings.Join(tmp.Env(), "\n"); strings.Contains(env, "-buildvcs=false") {
+		t.Error("GOFLAGS still set after Reset")
+	}
+}
+
+func TestWithGoPrivate(t *testing.T) {
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "", nil, WithGoPrivate("example.com/private/*", "corp.example"))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	env := strings.Join(tmp.Env(), "\n")
+	for _, want := range []string{"GOPRIVATE=example.com/private/*,corp.example", "GONOSUMDB=example.com/private/*,corp.example"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("Env is missing %s", want)
+		}
+	}
+	tmp.Reset()
+	if env := strings.Join(tmp.Env(), "\n"); strings.Contains(env, "corp.example") {
+		t.Error("GOPRIVATE still set after Reset")
+	}
+}
+
+func TestAddToPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("tool is a shell script")
+	}
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	tools := filepath.Join(tmp.Path, "tools")
+	if err := os.Mkdir(tools, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tools, "fakegopath-hello"), []byte("#!/bin/sh\necho hello \"$@\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	tmp.AddToPath(tools)
+	stdout, stderr, err := tmp.Run("fakegopath-hello", "world")
+	if err != nil {
+		t.Fatalf("Run failed: %v\n%s", err, stderr)
+	}
+	if stdout != "hello world\n" {
+		t.Errorf("Run output = %q, want hello world", stdout)
+	}
+	// Subprocesses find it through PATH too.
+	if stdout, _, err := tmp.Run("sh", "-c", "fakegopath-hello"); err != nil || stdout != "hello\n" {
+		t.Errorf("subprocess output = %q, %v, want hello", stdout, err)
+	}
+}
+
+func TestWithCleanEnv(t *testing.T) {
+	t.Setenv("FAKEGOPATH_TEST_LEAK", "1")
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithCleanEnv(map[string]string{"LANG": "C"}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	got := map[string]bool{}
+	for _, e := range tmp.Env() {
+		got[strings.SplitN(e, "=", 2)[0]] = true
+	}
+	for _, k := range []string{"LANG", "PATH", "GOPATH", "GO111MODULE"} {
+		if !got[k] {
+			t.Errorf("Env is missing %s", k)
+		}
+	}
+	if got["FAKEGOPATH_TEST_LEAK"] {
+		t.Error("Env contains a variable from the process environment")
+	}
+	stdout, _, err := tmp.Run("sh", "-c", "echo $FAKEGOPATH_TEST_LEAK$LANG")
+	if err != nil || stdout != "C\n" {
+		t.Errorf("subprocess saw %q, %v, want only LANG", stdout, err)
+	}
+}
+
+func TestCopyThrough(t *testing.T) {
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("tr is not installed")
+	}
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	src := filepath.Join(t.TempDir(), "in.txt")
+	if err := ioutil.WriteFile(src, []byte("hello, world\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmp.CopyThrough(filepath.Join("p", "out.txt"), src, []string{"tr", "a-z", "A-Z"}); err != nil {
+		t.Fatalf("CopyThrough failed: %v", err)
+	}
+	tmp.AssertFileEquals(t, filepath.Join("p", "out.txt"), []byte("HELLO, WORLD\n"))
+
+	err = tmp.CopyThrough("fail.txt", src, []string{"sh", "-c", "echo broken >&2; exit 1"})
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("failing command returned %v, want an error including its stderr", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp.Src, "fail.txt")); !os.IsNotExist(err) {
+		t.Errorf("failing command wrote its output: %v", err)
+	}
+	if err := tmp.CopyThrough("none.txt", src, nil); err == nil {
+		t.Error("CopyThrough with no command succeeded")
+	}
+}
+
+func TestListJSON(t *testing.T) {
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "1.16", mapToSourceFiles(map[string][]byte{
+		"a/a.go":   []byte("package a\n"),
+		"b/b.go":   []byte("package b\n\nimport _ \"example.com/m/a\"\n"),
+		"b/c/c.go": []byte("package c\n"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	out, err := tmp.ListJSON("./...")
+	if err != nil {
+		t.Fatalf("ListJSON failed: %v", err)
+	}
+	var paths []string
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var pkg struct{ ImportPath string }
+		if err := dec.Decode(&pkg); err != nil {
+			t.Fatalf("failed to decode go list output: %v\n%s", err, out)
+		}
+		paths = append(paths, pkg.ImportPath)
+	}
+	if want := []string{"example.com/m/a", "example.com/m/b", "example.com/m/b/c"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("listed %v, want %v", paths, want)
+	}
+	if _, err := tmp.ListJSON("example.com/m/missing"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("listing a missing package = %v, want an error with go's output", err)
+	}
+}
+
+func TestStreamGo(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"slow/slow.go": []byte("package slow\n"),
+		"slow/slow_test.go": []byte("package slow\n\nimport (\n\t\"testing\"\n\t\"time\"\n)\n\n" +
+			"func TestA(t *testing.T) { time.Sleep(300 * time.Millisecond) }\n\n" +
+			"func TestB(t *testing.T) { time.Sleep(300 * time.Millisecond) }\n\n" +
+			"func TestC(t *testing.T) { time.Sleep(300 * time.Millisecond) }\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	var lines []string
+	var times []time.Time
+	err = tmp.StreamGo([]string{"test", "-v", "-count=1", "slow"}, func(line string) {
+		lines = append(lines, line)
+		times = append(times, time.Now())
+	})
+	if err != nil {
+		t.Fatalf("StreamGo failed: %v\n%s", err, strings.Join(lines, "\n"))
+	}
+	find := func(prefix string) int {
+		for i, l := range lines {
+			if strings.HasPrefix(l, prefix) {
+				return i
+			}
+		}
+		t.Fatalf("no line starting with %q in:\n%s", prefix, strings.Join(lines, "\n"))
+		return -1
+	}
+	tests := []string{"TestA", "TestB", "TestC"}
+	for i, name := range tests {
+		run, pass := find("=== RUN   "+name), find("--- PASS: "+name)
+		// Each test's lines arrive while it runs, so its RUN line comes well before its PASS line.
+		if gap := times[pass].Sub(times[run]); pass < run || gap < 200*time.Millisecond {
+			t.Errorf("%s: PASS line %d arrived %v after RUN line %d, want it streamed as the test runs", name, pass, gap, run)
+		}
+		if i+1 < len(tests) {
+			if next := find("=== RUN   " + tests[i+1]); next < pass {
+				t.Errorf("%s started before %s passed", tests[i+1], name)
+			}
+		}
+	}
+	if log := tmp.goLog.String(); !strings.Contains(log, "$ go test -v -count=1 slow\n") || !strings.Contains(log, "--- PASS: TestC") {
+		t.Errorf("streamed command not in the go command log:\n%s", log)
+	}
+	if err := tmp.StreamGo([]string{"test", "missing"}, func(string) {}); err == nil {
+		t.Error("StreamGo of a missing package succeeded")
+	}
+}
+
+func TestRunUsesEnvPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("tool is a shell script")
+	}
+	tools := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(tools, "tool"), []byte("#!/bin/sh\necho tool\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.LookPath("tool"); err == nil {
+		t.Fatal("tool is on the process PATH")
+	}
+	// PATH in Env holds only tools, so programs on the process PATH are not found.
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithCleanEnv(map[string]string{"PATH": tools}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if stdout, _, err := tmp.Run("tool"); err != nil || stdout != "tool\n" {
+		t.Errorf("Run(tool) = %q, %v, want the tool on the tree's PATH", stdout, err)
+	}
+	if _, _, err := tmp.Run("go", "version"); err == nil {
+		t.Error("Run found go, which is only on the process PATH")
+	}
+}
@@ -3,41 +3,108 @@ package fakegopath
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"go/build"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
 	"text/template"
 )
 
 // Temporary is a temporary go source tree. The path is optionally appended to go.build.Default.GOPATH.
+// A Temporary created by NewTemporaryModule is instead a module-style tree, rooted at a go.mod.
 type Temporary struct {
-	Path      string // The path that is appended.
-	Orig      string // The original GOPATH
-	Pkg       string // The pkg directory
-	Src       string // The src directory
-	Bin       string // The bin directory
-	update    bool
-	deleteDir bool
+	Path       string // The path that is appended.
+	Orig       string // The original GOPATH
+	Pkg        string // The pkg directory
+	Src        string // The src directory
+	Bin        string // The bin directory
+	update     bool
+	deleteDir  bool
+	path       []string          // Directories prefixed to PATH in Env.
+	copyBuf    int               // Buffer size used when writing files, if non-zero.
+	vars       map[string]string // Variables set in Env, in addition to GOPATH.
+	canonical  string            // Path with symlinks resolved, as added to GOPATH.
+	module     string            // The module path, for module-style trees.
+	maxImport  int64             // Files larger than this are skipped by CopyDir, if non-zero.
+	funcs      template.FuncMap  // Functions available to templates parsed by GenerateFileFromPath.
+	ctxFuncs   []func(*build.Context)
+	provider   Provider               // Fetches files missing from the tree, if set.
+	goLog      *commandLog            // The go commands run against the tree and their output.
+	rewritePkg bool                   // Whether copied .go files have their package clause rewritten.
+	validate   bool                   // Whether the constructor checks that the tree builds.
+	cleanEnv   map[string]string      // The base environment for Env, if not inheriting the process environment.
+	shared     bool                   // Whether this is a tree from FreezeShared, which Reset leaves alone.
+	goimports  bool                   // Whether .go files are run through goimports when written.
+	nested     map[string]string      // Maps the roots of nested modules, relative to Src, to their module paths.
+	maxTotal   int64                  // The limit on the size of the src directory, if non-zero.
+	used       int64                  // The size of the src directory, updated by the methods that write to it.
+	cleanups   []func() error         // Functions run by Reset, in reverse order.
+	crlf       bool                   // Whether text files are written with CRLF line endings.
+	skipTests  bool                   // Whether CopyDir skips _test.go files.
+	less       func(a, b string) bool // The order for CopyDir, Walk and Files, if not lexical.
+	lowercase  bool                   // Whether CopyDir lowercases file names.
+	dedup      bool                   // Whether Copy hard links entries with identical contents.
 }
 
+// SourceFile is a file to create in a tree. Its contents come from Template if set, then Content if
+// not nil, and otherwise from the file at Src.
 type SourceFile struct {
-	Src     string
-	Dest    string
-	Content []byte
+	Src      string
+	Dest     string
+	Content  []byte
+	Template *template.Template // Executed with Data to generate the file, as with GenerateFile.
+	Data     interface{}
+}
+
+// Option configures a Temporary. Options are passed to the constructors, which apply them before any
+// files are written, or to Configure for an existing tree.
+type Option func(*Temporary) error
+
+// Configure applies opts to the tree in order, stopping at the first that fails.
+// Trees from FreezeShared can't be configured.
+func (t *Temporary) Configure(opts ...Option) error {
+	if t.shared {
+		return fmt.Errorf("cannot configure shared tree %s", t.Path)
+	}
+	for _, opt := range opts {
+		if err := opt(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithValidateBuild makes NewTemporaryWithFiles and NewTemporaryModuleWithFiles run go build ./... after
+// copying files, failing with the build output if the tree doesn't compile.
+func WithValidateBuild() Option {
+	return func(t *Temporary) error {
+		t.validate = true
+		return nil
+	}
 }
 
 // NewTemporaryWithFiles creates a temporary go source tree after copying/creating files.
 // prefix is used to create a temporary directory in which the source tree is created.
-func NewTemporaryWithFiles(prefix string, files []SourceFile) (*Temporary, error) {
+func NewTemporaryWithFiles(prefix string, files []SourceFile, opts ...Option) (*Temporary, error) {
+	return newTemporaryWithFiles(prefix, files, func(dir string) (*Temporary, error) { return NewTemporary(dir, true, opts...) })
+}
+
+func newTemporaryWithFiles(prefix string, files []SourceFile, create func(dir string) (*Temporary, error)) (*Temporary, error) {
 	dir, err := ioutil.TempDir("", prefix)
 	if err != nil {
 		return nil, err
 	}
-	t, err := NewTemporary(dir, true)
+	t, err := create(dir)
 	if err != nil {
 		os.RemoveAll(dir)
 		return nil, err
@@ -47,56 +114,212 @@ func NewTemporaryWithFiles(prefix string, files []SourceFile) (*Temporary, error
 		t.Reset()
 		return nil, err
 	}
+	if t.validate {
+		if _, stderr, err := t.RunGo("build", "./..."); err != nil {
+			t.Reset()
+			return nil, fmt.Errorf("tree does not build: %v\n%s", err, stderr)
+		}
+	}
 	return t, nil
 }
 
-// CopyFiles copies all source files in files using t.CopyFile or t.WriteFile as needed.
+// NewTemporaryFromMap creates a temporary go source tree containing files, which maps
+// slash separated paths relative to the src directory to their contents.
+func NewTemporaryFromMap(prefix string, files map[string][]byte, opts ...Option) (*Temporary, error) {
+	return NewTemporaryWithFiles(prefix, mapToSourceFiles(files), opts...)
+}
+
+// TestFS returns a file system view of a temporary tree containing files, keyed as for NewTemporaryFromMap.
+// The tree does not update GOPATH and is removed when tb finishes.
+func TestFS(tb testing.TB, files map[string][]byte) fs.FS {
+	tb.Helper()
+	t, err := newTemporaryWithFiles("fakegopath", mapToSourceFiles(files), func(dir string) (*Temporary, error) {
+		return NewTemporary(dir, false)
+	})
+	if err != nil {
+		tb.Fatalf("failed to create tree: %v", err)
+	}
+	tb.Cleanup(t.Reset)
+	return os.DirFS(t.Src)
+}
+
+func mapToSourceFiles(files map[string][]byte) []SourceFile {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	src := make([]SourceFile, 0, len(paths))
+	for _, p := range paths {
+		content := files[p]
+		if content == nil {
+			content = []byte{}
+		}
+		src = append(src, SourceFile{Dest: filepath.FromSlash(p), Content: content})
+	}
+	return src
+}
+
+// ToMap returns the contents of every file in the src directory, keyed by slash separated relative path.
+// It is the inverse of NewTemporaryFromMap.
+func (t *Temporary) ToMap() (map[string][]byte, error) { return readTree(t.Src) }
+
+// CopyFiles copies all source files in files using t.GenerateFile, t.CopyFile or t.WriteFile as needed.
+// With WithDedupLinks, entries with identical Content, or the same Src, are written once and hard linked where supported.
 func (t *Temporary) Copy(files []SourceFile) error {
+	dirs := dirCache{}
+	written := map[string]string{} // Maps a dedup key to the first file written for it.
+	keys := map[string]string{}    // The inverse of written.
 	for _, f := range files {
-		if f.Content != nil {
-			if err := t.WriteFile(f.Dest, bytes.NewBuffer(f.Content)); err != nil {
+		fullPath := filepath.Join(t.Src, f.Dest)
+		if k, ok := keys[fullPath]; ok {
+			// The file is about to be replaced, so it no longer holds the contents for k.
+			delete(written, k)
+			delete(keys, fullPath)
+		}
+		key := t.dedupKey(f)
+		if first, ok := written[key]; ok {
+			if err := t.link(f.Dest, first, dirs); err == nil {
+				continue
+			}
+		}
+		switch {
+		case f.Template != nil:
+			if err := t.GenerateFile(f.Dest, f.Template, f.Data); err != nil {
+				return err
+			}
+		case f.Content != nil:
+			if err := t.writeFile(f.Dest, bytes.NewBuffer(f.Content), dirs); err != nil {
+				return err
+			}
+		default:
+			if err := t.copyFile(f.Dest, f.Src, dirs); err != nil {
 				return err
 			}
-			continue
 		}
-		if err := t.CopyFile(f.Dest, f.Src); err != nil {
-			return err
+		if key != "" {
+			written[key], keys[fullPath] = fullPath, key
 		}
 	}
 	return nil
 }
 
+// dedupKey returns a key that is equal for entries of files which produce identical contents,
+// or "" if f should not be deduplicated.
+func (t *Temporary) dedupKey(f SourceFile) string {
+	if !t.dedup {
+		return ""
+	}
+	if f.Template != nil || t.goimports {
+		// goimports output depends on the destination.
+		return ""
+	}
+	if f.Content != nil {
+		return fmt.Sprintf("content:%x", sha256.Sum256(f.Content))
+	}
+	if t.rewritePkg && filepath.Ext(f.Src) == ".go" {
+		// The package clause depends on the destination.
+		return ""
+	}
+	if abs, err := filepath.Abs(f.Src); err == nil {
+		return "src:" + abs
+	}
+	return ""
+}
+
+// link hard links file, a path relative to the src directory, to existing.
+func (t *Temporary) link(file, existing string, dirs dirCache) error {
+	fullPath := filepath.Join(t.Src, file)
+	if err := dirs.mkdirAll(filepath.Dir(fullPath)); err != nil {
+		return err
+	}
+	old, n := fileSize(fullPath), fileSize(existing)
+	if err := t.reserve(old, n); err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		t.used -= n - old
+		return err
+	}
+	if err := os.Link(existing, fullPath); err != nil {
+		t.used -= n
+		return err
+	}
+	return nil
+}
+
 func (t *Temporary) KeepTempDir(keep bool) { t.deleteDir = !keep }
 
-// NewTemporary creates a temporary under the specified directory.
+// WithDedupLinks makes Copy write entries with identical Content, or the same Src, once and hard link the rest,
+// saving time and space for large manifests with repeated files. The linked files share their contents:
+// WriteFile and the tree's other methods replace a file rather than writing to it, but anything that edits
+// one of them in place, such as a tool under test or ioutil.WriteFile, changes all of them.
+func WithDedupLinks(enable bool) Option {
+	return func(t *Temporary) error {
+		t.dedup = enable
+		return nil
+	}
+}
+
+// WithCopyBufferSize makes WriteFile and CopyFile copy through a buffer of n bytes.
+// If n is zero, the default io.Copy behaviour is used.
+func WithCopyBufferSize(n int) Option {
+	return func(t *Temporary) error {
+		t.copyBuf = n
+		return nil
+	}
+}
+
+// NewTemporary creates a temporary under the specified directory, configured by opts.
 // If updateGoPath is true, go.build.Default.GOPATH will have this path prefixed to it.
-func NewTemporary(dir string, updateGoPath bool) (*Temporary, error) {
+// Multiple temporaries may update GOPATH at once; each is prefixed in creation order.
+func NewTemporary(dir string, updateGoPath bool, opts ...Option) (*Temporary, error) {
 	t := &Temporary{
 		Path:      dir,
 		Pkg:       filepath.Join(dir, "pkg"),
 		Src:       filepath.Join(dir, "src"),
 		Bin:       filepath.Join(dir, "bin"),
+		Orig:      build.Default.GOPATH,
 		update:    updateGoPath,
 		deleteDir: false,
+		goLog:     &commandLog{},
 	}
 
-	for _, d := range []string{t.Src, t.Pkg, t.Bin} {
-		if err := os.MkdirAll(d, 0700); err != nil {
-			return nil, fmt.Errorf("failed to create %s: %v", d, err)
-		}
+	if err := t.mkdirs(t.Src, t.Pkg, t.Bin); err != nil {
+		return nil, err
 	}
 
 	if t.update {
-		t.Orig = build.Default.GOPATH
 		if os.Getenv("GOPATH") != t.Orig {
 			return nil, fmt.Errorf("GOPATH %s doesn't match build.Default.GOPATH %s", os.Getenv("GOPATH"), t.Orig)
 		}
-		build.Default.GOPATH = dir + ":" + build.Default.GOPATH
-		os.Setenv("GOPATH", build.Default.GOPATH)
+		addGoPath(t.canonical)
+	}
+	trackTemporary(t)
+	if err := t.Configure(opts...); err != nil {
+		t.Reset()
+		return nil, err
 	}
 	return t, nil
 }
 
+// mkdirs creates dirs and resolves the canonical path of the tree.
+func (t *Temporary) mkdirs(dirs ...string) error {
+	for _, d := range dirs {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return fmt.Errorf("failed to create %s: %v", d, err)
+		}
+	}
+	// go/build compares GOPATH entries against resolved paths, so a tree under a symlinked
+	// directory (e.g. /tmp on macOS) must be added to GOPATH by its canonical path.
+	canonical, err := filepath.EvalSymlinks(t.Path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", t.Path, err)
+	}
+	t.canonical = canonical
+	return nil
+}
+
 func loggedClose(file string, closer io.Closer) { logError("failed to close "+file, closer.Close()) }
 func logError(msg string, err error) {
 	if err != nil {
@@ -113,44 +336,412 @@ func (t *Temporary) GenerateFile(file string, tpl *template.Template, args inter
 	return t.WriteFile(file, buf)
 }
 
+// WithFuncMap sets the functions available to templates parsed by GenerateFileFromPath.
+func WithFuncMap(funcs template.FuncMap) Option {
+	return func(t *Temporary) error {
+		t.funcs = funcs
+		return nil
+	}
+}
+
+// GenerateFileFromPath is equivalent to GenerateFile with the template parsed from templatePath.
+func (t *Temporary) GenerateFileFromPath(file, templatePath string, args interface{}) error {
+	b, err := ioutil.ReadFile(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read template %s: %v", templatePath, err)
+	}
+	tpl, err := template.New(filepath.Base(templatePath)).Funcs(t.funcs).Parse(string(b))
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %v", templatePath, err)
+	}
+	return t.GenerateFile(file, tpl, args)
+}
+
+// GenerateFileAt is equivalent to GenerateFile with file given by executing pathTpl, a slash separated
+// path template such as "cmd/{{.Name}}/main.go", against data.
+func (t *Temporary) GenerateFileAt(pathTpl string, contentTpl *template.Template, data interface{}) error {
+	tpl, err := template.New("path").Funcs(t.funcs).Parse(pathTpl)
+	if err != nil {
+		return fmt.Errorf("failed to parse path template %q: %v", pathTpl, err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := tpl.Execute(buf, data); err != nil {
+		return fmt.Errorf("failed to generate path from %q: %v", pathTpl, err)
+	}
+	return t.GenerateFile(filepath.FromSlash(buf.String()), contentTpl, data)
+}
+
+// GenerateFileIfAbsent is equivalent to GenerateFile, except that an existing file is left untouched.
+// It returns whether file was created.
+func (t *Temporary) GenerateFileIfAbsent(file string, tpl *template.Template, args interface{}) (bool, error) {
+	if _, err := os.Stat(filepath.Join(t.Src, file)); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to stat %s: %v", file, err)
+	}
+	if err := t.GenerateFile(file, tpl, args); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // CopyFile is equivalent to WriteFile with the contents of src.
-func (t *Temporary) CopyFile(dest, src string) error {
+func (t *Temporary) CopyFile(dest, src string) error { return t.copyFile(dest, src, nil) }
+
+func (t *Temporary) copyFile(dest, src string, dirs dirCache) error {
+	if t.rewritePkg && filepath.Ext(src) == ".go" {
+		return t.copyRewritten(dest, src, dirs)
+	}
 	input, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open %s: %v", src, err)
 	}
 	defer loggedClose(src, input)
-	return t.WriteFile(dest, input)
+	return t.writeFile(dest, input, dirs)
 }
 
 // WriteFile writes contents to file, where file is a path relative to the src directory.
 // Any intermediate directories are created if needed.
 func (t *Temporary) WriteFile(file string, contents io.Reader) error {
+	return t.writeFile(file, contents, nil)
+}
+
+func (t *Temporary) writeFile(file string, contents io.Reader, dirs dirCache) error {
+	contents, err := t.transform(file, contents)
+	if err != nil {
+		return err
+	}
+	return t.writeTransformed(file, contents, dirs)
+}
+
+// transform returns contents as they are written to file, after the changes made by WithGoImports and WithForceCRLF.
+func (t *Temporary) transform(file string, contents io.Reader) (io.Reader, error) {
+	if t.goimports && filepath.Ext(file) == ".go" {
+		fixed, err := t.runGoImports(file, contents)
+		if err != nil {
+			return nil, err
+		}
+		contents = fixed
+	}
+	if t.crlf {
+		converted, err := toCRLF(contents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read contents of %s: %v", file, err)
+		}
+		contents = converted
+	}
+	return contents, nil
+}
+
+// writeTransformed writes contents to file, like WriteFile, without transforming them.
+func (t *Temporary) writeTransformed(file string, contents io.Reader, dirs dirCache) error {
 	fullPath := filepath.Join(t.Src, file)
 	fileDir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(fileDir, 0700); err != nil {
+	if err := dirs.mkdirAll(fileDir); err != nil {
 		return fmt.Errorf("failed to create dir %s: %v", fileDir, err)
 	}
-	w, err := os.OpenFile(fullPath, os.O_CREATE|os.O_RDWR, 0600)
+	// Remove any existing file rather than truncating it, so that files hard linked by Copy are not changed.
+	old := fileSize(fullPath)
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %v", fullPath, err)
+	}
+	t.used -= old
+	w, err := os.OpenFile(fullPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
 	if err != nil {
 		return fmt.Errorf("couldn't open %s for writing: %v", fullPath, err)
 	}
 	defer loggedClose(fullPath, w)
-	if _, err := io.Copy(w, contents); err != nil {
+	var out io.Writer = w
+	if t.maxTotal > 0 {
+		out = &quotaWriter{w: w, left: t.maxTotal - t.used}
+	}
+	n, err := t.copy(out, contents)
+	t.used += n
+	if err == ErrQuotaExceeded {
+		t.used -= n
+		logError("failed to remove "+fullPath, os.Remove(fullPath))
+		return ErrQuotaExceeded
+	}
+	if err != nil {
 		return fmt.Errorf("copy failed: %v", err)
 	}
 	return nil
 }
 
-// Reset resets the original GOPATH and deletes the temporary directory.
+// ErrQuotaExceeded is returned by WriteFile and the other methods that write to the tree when a write would
+// take the size of the src directory past the limit set by WithMaxTotalSize. A file being written by WriteFile
+// is removed.
+var ErrQuotaExceeded = errors.New("fakegopath: tree size quota exceeded")
+
+// WithMaxTotalSize limits the total size of the files in the src directory, excluding Bin, to n bytes.
+// Files already in the tree count towards the limit, an overwritten file only counts with its new size,
+// and hard links made by Copy count as separate files. Writes by the tree's methods that would cross
+// the limit fail with ErrQuotaExceeded; files changed by other means, e.g. by go mod tidy, are not counted.
+// If n is zero, there is no limit.
+func WithMaxTotalSize(n int64) Option {
+	return func(t *Temporary) error {
+		var used int64
+		err := walkFiles(t.Src, func(rel string, info os.FileInfo) error {
+			if full := filepath.Join(t.Src, filepath.FromSlash(rel)); !strings.HasPrefix(full, t.Bin+string(filepath.Separator)) {
+				used += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		t.maxTotal, t.used = n, used
+		return nil
+	}
+}
+
+// reserve accounts for a file in the src directory changing size from old to n bytes. It fails with
+// ErrQuotaExceeded if the file grows and the tree would be larger than the limit set by WithMaxTotalSize.
+func (t *Temporary) reserve(old, n int64) error {
+	if t.maxTotal > 0 && n > old && t.used-old+n > t.maxTotal {
+		return ErrQuotaExceeded
+	}
+	t.used += n - old
+	return nil
+}
+
+// fileSize returns the size of the regular file at fullPath, or 0 if there is none.
+func fileSize(fullPath string) int64 {
+	if info, err := os.Lstat(fullPath); err == nil && info.Mode().IsRegular() {
+		return info.Size()
+	}
+	return 0
+}
+
+// quotaWriter fails writes once more than left bytes have been written.
+type quotaWriter struct {
+	w    io.Writer
+	left int64
+}
+
+func (q *quotaWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > q.left {
+		return 0, ErrQuotaExceeded
+	}
+	n, err := q.w.Write(p)
+	q.left -= int64(n)
+	return n, err
+}
+
+// WriteSparseFile creates file with the given size, containing chunks at their offsets and zeros elsewhere.
+// The zero regions are left as holes on file systems that support them.
+func (t *Temporary) WriteSparseFile(file string, size int64, chunks map[int64][]byte) error {
+	fullPath := filepath.Join(t.Src, file)
+	for off, c := range chunks {
+		if off < 0 || off+int64(len(c)) > size {
+			return fmt.Errorf("chunk at %d of length %d is outside %s of size %d", off, len(c), file, size)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return fmt.Errorf("failed to create dir %s: %v", filepath.Dir(fullPath), err)
+	}
+	// Sparse files count towards WithMaxTotalSize with their full size.
+	old := fileSize(fullPath)
+	if err := t.reserve(old, size); err != nil {
+		return err
+	}
+	// As in writeFile, don't truncate files that Copy may have hard linked.
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		t.used -= size - old
+		return fmt.Errorf("failed to remove %s: %v", fullPath, err)
+	}
+	w, err := os.OpenFile(fullPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't open %s for writing: %v", fullPath, err)
+	}
+	defer loggedClose(fullPath, w)
+	if err := w.Truncate(size); err != nil {
+		return fmt.Errorf("failed to resize %s: %v", fullPath, err)
+	}
+	for off, c := range chunks {
+		if _, err := w.WriteAt(c, off); err != nil {
+			return fmt.Errorf("failed to write %s at %d: %v", fullPath, off, err)
+		}
+	}
+	return nil
+}
+
+// dirCache records the directories created during a single Copy or CopyDir, so that each is created at most once.
+// A nil dirCache creates directories every time.
+type dirCache map[string]bool
+
+// mkdirAll is os.MkdirAll, replaced by tests to count calls.
+var mkdirAll = os.MkdirAll
+
+func (c dirCache) mkdirAll(dir string) error {
+	if c[dir] {
+		return nil
+	}
+	if err := mkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if c != nil {
+		c[dir] = true
+	}
+	return nil
+}
+
+func (t *Temporary) copy(w io.Writer, r io.Reader) (int64, error) {
+	if t.copyBuf <= 0 {
+		return io.Copy(w, r)
+	}
+	// Hide ReaderFrom and WriterTo so that the buffer is actually used.
+	return io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{r}, make([]byte, t.copyBuf))
+}
+
+// WriteFileIfChanged writes contents to file, like WriteFile, unless file already has the contents WriteFile
+// would write, after options such as WithForceCRLF are applied. It returns whether file was written.
+// Unchanged files keep their modification time.
+func (t *Temporary) WriteFileIfChanged(file string, contents []byte) (bool, error) {
+	r, err := t.transform(file, bytes.NewReader(contents))
+	if err != nil {
+		return false, err
+	}
+	if contents, err = ioutil.ReadAll(r); err != nil {
+		return false, fmt.Errorf("failed to read contents of %s: %v", file, err)
+	}
+	existing, err := ioutil.ReadFile(filepath.Join(t.Src, file))
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	if err == nil && sha256.Sum256(existing) == sha256.Sum256(contents) {
+		return false, nil
+	}
+	if err := t.writeTransformed(file, bytes.NewReader(contents), nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddCleanup registers fn to be run by Reset, so that resources related to the tree are torn down with it.
+// Cleanups run in the reverse order to which they were added. Any errors are logged together.
+func (t *Temporary) AddCleanup(fn func() error) { t.cleanups = append(t.cleanups, fn) }
+
+func (t *Temporary) runCleanups() {
+	var msgs []string
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		if err := t.cleanups[i](); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	t.cleanups = nil
+	if len(msgs) > 0 {
+		logError("cleanup failed:", errors.New(strings.Join(msgs, "; ")))
+	}
+}
+
+// Reset removes this tree from GOPATH and deletes the temporary directory.
+// Entries added by other temporaries are left in place, in their original order.
+// Reset does nothing for trees returned by FreezeShared.
+// Functions registered with AddCleanup are run first, in reverse order of registration.
 func (t *Temporary) Reset() {
+	if t.shared {
+		return
+	}
+	t.runCleanups()
 	if t.update {
-		build.Default.GOPATH = t.Orig
-		os.Setenv("GOPATH", t.Orig)
+		removeBuildContext(t)
+		removeGoPath(t.canonical)
 	}
+	t.path, t.vars = nil, nil
+	untrackTemporary(t)
 	if t.deleteDir {
 		if err := os.RemoveAll(t.Path); err != nil {
 			log.Println(err)
 		}
 	}
 }
+
+// walkFiles calls fn for every regular file under root in lexical order, with rel being the slash separated path relative to root.
+func walkFiles(root string, fn func(rel string, info os.FileInfo) error) error {
+	return walkFilesOrdered(root, nil, fn)
+}
+
+// walkFilesOrdered is like walkFiles, but visits the entries of each directory in the order given by less,
+// which compares slash separated paths relative to root. If less is nil, entries are visited in lexical order.
+func walkFilesOrdered(root string, less func(a, b string) bool, fn func(rel string, info os.FileInfo) error) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if info.Mode().IsRegular() {
+			return fn(".", info)
+		}
+		return nil
+	}
+	return walkDir(root, "", less, fn)
+}
+
+func walkDir(root, rel string, less func(a, b string) bool, fn func(rel string, info os.FileInfo) error) error {
+	infos, err := ioutil.ReadDir(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+	if less != nil {
+		sort.SliceStable(infos, func(i, j int) bool {
+			return less(path.Join(rel, infos[i].Name()), path.Join(rel, infos[j].Name()))
+		})
+	}
+	for _, info := range infos {
+		p := path.Join(rel, info.Name())
+		switch {
+		case info.IsDir():
+			err = walkDir(root, p, less, fn)
+		case info.Mode().IsRegular():
+			err = fn(p, info)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithWalkOrder sets the order in which CopyDir, Walk and Files visit the entries of each directory.
+// less compares slash separated paths of entries in the same directory. If less is nil, the order is lexical.
+func WithWalkOrder(less func(a, b string) bool) Option {
+	return func(t *Temporary) error {
+		t.less = less
+		return nil
+	}
+}
+
+// Walk calls fn with the slash separated path, relative to the src directory, of every file in the tree,
+// in the order set by WithWalkOrder. Walk stops at the first error returned by fn.
+func (t *Temporary) Walk(fn func(file string) error) error {
+	return walkFilesOrdered(t.Src, t.less, func(rel string, _ os.FileInfo) error { return fn(rel) })
+}
+
+// Files returns the slash separated paths, relative to the src directory, of every file in the tree,
+// in the order set by WithWalkOrder.
+func (t *Temporary) Files() ([]string, error) {
+	var files []string
+	err := t.Walk(func(file string) error {
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
+
+// readTree returns the contents of every file under root, keyed by slash separated relative path.
+func readTree(root string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := walkFiles(root, func(rel string, _ os.FileInfo) error {
+		b, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		files[rel] = b
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", root, err)
+	}
+	return files, nil
+}
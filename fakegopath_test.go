@@ -0,0 +1,616 @@
+package fakegopath
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// NewTemporary refuses to update GOPATH unless the environment agrees with go/build.
+	if os.Getenv("GOPATH") == "" {
+		os.Setenv("GOPATH", build.Default.GOPATH)
+	}
+	RegisterLeakCheck()
+	code := m.Run()
+	ResetShared()
+	if err := CheckLeaks(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	os.Exit(code)
+}
+
+func TestExternallyRemovedTree(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"p/p.go": []byte("package p\n")})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := os.RemoveAll(tmp.Src); err != nil {
+		t.Fatalf("failed to remove src: %v", err)
+	}
+	if err := tmp.WriteFile(filepath.Join("q", "q.go"), strings.NewReader("package q\n")); err != nil {
+		t.Errorf("WriteFile after src was removed failed: %v", err)
+	}
+	if err := os.RemoveAll(tmp.Path); err != nil {
+		t.Fatalf("failed to remove tree: %v", err)
+	}
+	tmp.Reset()
+	if logged.Len() > 0 {
+		t.Errorf("Reset of a removed tree logged: %s", logged.String())
+	}
+}
+
+func TestToMapRoundTrip(t *testing.T) {
+	files := map[string][]byte{
+		"a/a.go":     []byte("package a\n"),
+		"a/b/b.go":   []byte("package b\n"),
+		"data/empty": {},
+	}
+	tmp, err := NewTemporaryFromMap("fakegopath", files)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	got, err := tmp.ToMap()
+	if err != nil {
+		t.Fatalf("ToMap failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Errorf("ToMap = %q, want %q", got, files)
+	}
+}
+
+func TestWriteFileIfChanged(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	file := filepath.Join("p", "p.go")
+	if changed, err := tmp.WriteFileIfChanged(file, []byte("package p\n")); err != nil || !changed {
+		t.Fatalf("first WriteFileIfChanged = %v, %v, want true, nil", changed, err)
+	}
+	// Move the modification time into the past so that a rewrite would be visible.
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	fullPath := filepath.Join(tmp.Src, file)
+	if err := os.Chtimes(fullPath, past, past); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+	if changed, err := tmp.WriteFileIfChanged(file, []byte("package p\n")); err != nil || changed {
+		t.Fatalf("second WriteFileIfChanged = %v, %v, want false, nil", changed, err)
+	}
+	if info, err := os.Stat(fullPath); err != nil || !info.ModTime().Equal(past) {
+		t.Errorf("unchanged file was rewritten: %v, %v", info.ModTime(), err)
+	}
+	if changed, err := tmp.WriteFileIfChanged(file, []byte("package q\n")); err != nil || !changed {
+		t.Errorf("WriteFileIfChanged with new contents = %v, %v, want true, nil", changed, err)
+	}
+}
+
+func TestCopyBufferSize(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "large")
+	contents := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	if err := ioutil.WriteFile(src, contents, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", src, err)
+	}
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithCopyBufferSize(7))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.CopyFile("large", src); err != nil {
+		t.Fatalf("CopyFile failed: %v", err)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(tmp.Src, "large")); err != nil || !bytes.Equal(got, contents) {
+		t.Errorf("copy through a 7 byte buffer differs from the source: %v", err)
+	}
+}
+
+func BenchmarkCopyBufferSize(b *testing.B) {
+	src := filepath.Join(b.TempDir(), "large")
+	contents := bytes.Repeat([]byte{'x'}, 8<<20)
+	if err := ioutil.WriteFile(src, contents, 0600); err != nil {
+		b.Fatalf("failed to write %s: %v", src, err)
+	}
+	for _, n := range []int{0, 512, 32 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("buffer=%d", n), func(b *testing.B) {
+			tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithCopyBufferSize(n))
+			if err != nil {
+				b.Fatalf("failed to create tree: %v", err)
+			}
+			defer tmp.Reset()
+			b.SetBytes(int64(len(contents)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := tmp.CopyFile("large", src); err != nil {
+					b.Fatalf("CopyFile failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateFileIfAbsent(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	tpl := template.Must(template.New("").Parse("package {{.}}\n"))
+	file := filepath.Join("p", "p.go")
+	if created, err := tmp.GenerateFileIfAbsent(file, tpl, "p"); err != nil || !created {
+		t.Fatalf("first GenerateFileIfAbsent = %v, %v, want true, nil", created, err)
+	}
+	edited := []byte("package p\n\n// Edited by hand.\n")
+	if err := ioutil.WriteFile(filepath.Join(tmp.Src, file), edited, 0600); err != nil {
+		t.Fatalf("failed to edit %s: %v", file, err)
+	}
+	if created, err := tmp.GenerateFileIfAbsent(file, tpl, "p"); err != nil || created {
+		t.Fatalf("second GenerateFileIfAbsent = %v, %v, want false, nil", created, err)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(tmp.Src, file)); err != nil || !bytes.Equal(got, edited) {
+		t.Errorf("manual edit was overwritten: got %q, %v", got, err)
+	}
+}
+
+// activeTemporaries returns the temporaries that have not been Reset.
+func activeTemporaries() map[*Temporary]bool {
+	leaks.Lock()
+	defer leaks.Unlock()
+	active := map[*Temporary]bool{}
+	for t := range leaks.active {
+		active[t] = true
+	}
+	return active
+}
+
+func TestTestFS(t *testing.T) {
+	before := activeTemporaries()
+	var created *Temporary
+	t.Run("consumer", func(t *testing.T) {
+		fsys := TestFS(t, map[string][]byte{"p/p.go": []byte("package p\n")})
+		if got, err := fs.ReadFile(fsys, "p/p.go"); err != nil || string(got) != "package p\n" {
+			t.Errorf("ReadFile = %q, %v, want package p", got, err)
+		}
+		for tmp := range activeTemporaries() {
+			if !before[tmp] {
+				created = tmp
+			}
+		}
+	})
+	if created == nil {
+		t.Fatal("TestFS didn't create a tree")
+	}
+	if activeTemporaries()[created] {
+		t.Error("tree was not reset when the test finished")
+	}
+	if _, err := os.Stat(created.Path); !os.IsNotExist(err) {
+		t.Errorf("tree %s was not removed: %v", created.Path, err)
+	}
+}
+
+// countMkdirAll counts the directories created through dirCache until the returned function is called.
+func countMkdirAll() (calls *int, restore func()) {
+	calls = new(int)
+	mkdirAll = func(path string, perm os.FileMode) error {
+		*calls++
+		return os.MkdirAll(path, perm)
+	}
+	return calls, func() { mkdirAll = os.MkdirAll }
+}
+
+// tinyFiles returns n small files spread over dirs directories.
+func tinyFiles(n, dirs int) []SourceFile {
+	files := make([]SourceFile, n)
+	for i := range files {
+		files[i] = SourceFile{
+			Dest:    filepath.Join(fmt.Sprintf("d%d", i%dirs), fmt.Sprintf("f%d.txt", i)),
+			Content: []byte(fmt.Sprintf("file %d\n", i)),
+		}
+	}
+	return files
+}
+
+func TestCopyCreatesEachDirOnce(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	calls, restore := countMkdirAll()
+	defer restore()
+	files := tinyFiles(100, 5)
+	if err := tmp.Copy(files); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if *calls != 5 {
+		t.Errorf("Copy called MkdirAll %d times, want once for each of 5 directories", *calls)
+	}
+	got, err := tmp.ToMap()
+	if err != nil {
+		t.Fatalf("ToMap failed: %v", err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("tree has %d files, want %d", len(got), len(files))
+	}
+	for _, f := range files {
+		if c := got[filepath.ToSlash(f.Dest)]; !bytes.Equal(c, f.Content) {
+			t.Errorf("%s = %q, want %q", f.Dest, c, f.Content)
+		}
+	}
+}
+
+func BenchmarkCopyTinyFiles(b *testing.B) {
+	files := tinyFiles(1000, 10)
+	calls, restore := countMkdirAll()
+	defer restore()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+		if err != nil {
+			b.Fatalf("failed to create tree: %v", err)
+		}
+		b.StartTimer()
+		if err := tmp.Copy(files); err != nil {
+			b.Fatalf("Copy failed: %v", err)
+		}
+		b.StopTimer()
+		tmp.Reset()
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(*calls)/float64(b.N), "mkdirs/op")
+}
+
+func TestGenerateFileFromPath(t *testing.T) {
+	dir := t.TempDir()
+	tplPath := filepath.Join(dir, "pkg.go.tmpl")
+	if err := ioutil.WriteFile(tplPath, []byte("package {{lower .}}\n"), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+	badPath := filepath.Join(dir, "bad.tmpl")
+	if err := ioutil.WriteFile(badPath, []byte("{{if}}"), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithFuncMap(template.FuncMap{"lower": strings.ToLower}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.GenerateFileFromPath(filepath.Join("p", "p.go"), tplPath, "P"); err != nil {
+		t.Fatalf("GenerateFileFromPath failed: %v", err)
+	}
+	tmp.AssertFileEquals(t, filepath.Join("p", "p.go"), []byte("package p\n"))
+	if err := tmp.GenerateFileFromPath("bad.go", badPath, nil); err == nil || !strings.Contains(err.Error(), badPath) {
+		t.Errorf("GenerateFileFromPath with a bad template = %v, want an error naming %s", err, badPath)
+	}
+}
+
+func TestWriteSparseFile(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	const size = 1 << 20
+	chunks := map[int64][]byte{0: []byte("head"), 4096: []byte("middle"), size - 4: []byte("tail")}
+	if err := tmp.WriteSparseFile(filepath.Join("data", "sparse.bin"), size, chunks); err != nil {
+		t.Fatalf("WriteSparseFile failed: %v", err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(tmp.Src, "data", "sparse.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, size)
+	for off, c := range chunks {
+		copy(want[off:], c)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("sparse file of size %d differs from expected contents of size %d", len(got), len(want))
+	}
+	if err := tmp.WriteSparseFile("bad.bin", 10, map[int64][]byte{8: []byte("abc")}); err == nil {
+		t.Error("WriteSparseFile with a chunk past the end succeeded")
+	}
+}
+
+func TestWithValidateBuild(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"p/p.go": []byte("package p\n")}, WithValidateBuild())
+	if err != nil {
+		t.Fatalf("valid tree failed validation: %v", err)
+	}
+	tmp.Reset()
+	before := activeTemporaries()
+	_, err = NewTemporaryFromMap("fakegopath", map[string][]byte{"p/p.go": []byte("package p\n\nvar X int = \"x\"\n")}, WithValidateBuild())
+	if err == nil || !strings.Contains(err.Error(), "p.go") {
+		t.Errorf("broken tree = %v, want an error with the build output", err)
+	}
+	if after := activeTemporaries(); len(after) != len(before) {
+		t.Error("broken tree was not reset")
+	}
+}
+
+func TestOptionsApplyBeforeFiles(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"a.txt": []byte("a\nb\n")}, WithForceCRLF(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	tmp.AssertFileEquals(t, "a.txt", []byte("a\r\nb\r\n"))
+	if err := tmp.Configure(WithForceCRLF(false)); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if err := tmp.WriteFile("b.txt", strings.NewReader("a\nb\n")); err != nil {
+		t.Fatal(err)
+	}
+	tmp.AssertFileEquals(t, "b.txt", []byte("a\nb\n"))
+}
+
+func TestCopyDedup(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", []SourceFile{
+		{Dest: filepath.Join("a", "LICENSE"), Content: []byte("license\n")},
+		{Dest: filepath.Join("b", "LICENSE"), Content: []byte("license\n")},
+		{Dest: filepath.Join("c", "LICENSE"), Content: []byte("license\n")},
+	}, WithDedupLinks(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	var infos []os.FileInfo
+	for _, d := range []string{"a", "b", "c"} {
+		info, err := os.Stat(filepath.Join(tmp.Src, d, "LICENSE"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, info)
+	}
+	if !os.SameFile(infos[0], infos[1]) || !os.SameFile(infos[0], infos[2]) {
+		t.Error("identical entries were not written once and linked")
+	}
+
+	// Rewriting one of the linked files leaves the others alone.
+	if err := tmp.WriteFile(filepath.Join("a", "LICENSE"), strings.NewReader("changed\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmp.WriteSparseFile(filepath.Join("b", "LICENSE"), 4, nil); err != nil {
+		t.Fatal(err)
+	}
+	tmp.AssertFileEquals(t, filepath.Join("c", "LICENSE"), []byte("license\n"))
+}
+
+func TestCopyDedupAfterOverwrite(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", []SourceFile{
+		{Dest: "p", Content: []byte("X")},
+		{Dest: "p", Content: []byte("Y")},
+		{Dest: "q", Content: []byte("X")},
+	}, WithDedupLinks(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	tmp.AssertFileEquals(t, "p", []byte("Y"))
+	tmp.AssertFileEquals(t, "q", []byte("X"))
+}
+
+func TestCopyDedupDisabledByGoImports(t *testing.T) {
+	tmp := &Temporary{dedup: true, goimports: true}
+	if key := tmp.dedupKey(SourceFile{Dest: "a.go", Content: []byte("package a\n")}); key != "" {
+		t.Errorf("dedupKey with goimports = %q, want no deduplication", key)
+	}
+}
+
+func TestCopyWithoutDedup(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", []SourceFile{
+		{Dest: filepath.Join("a", "LICENSE"), Content: []byte("license\n")},
+		{Dest: filepath.Join("b", "LICENSE"), Content: []byte("license\n")},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	// Identical entries are separate files by default, so editing one in place leaves the other alone.
+	if err := ioutil.WriteFile(filepath.Join(tmp.Src, "a", "LICENSE"), []byte("changed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tmp.AssertFileEquals(t, filepath.Join("b", "LICENSE"), []byte("license\n"))
+}
+
+func TestGenerateFileAt(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	content := template.Must(template.New("").Parse("package main\n\n// {{.Name}} is generated.\nfunc main() {}\n"))
+	if err := tmp.GenerateFileAt("app/{{.Name}}/main.go", content, struct{ Name string }{"tool"}); err != nil {
+		t.Fatalf("GenerateFileAt failed: %v", err)
+	}
+	tmp.AssertFileEquals(t, filepath.Join("app", "tool", "main.go"), []byte("package main\n\n// tool is generated.\nfunc main() {}\n"))
+	if err := tmp.GenerateFileAt("{{.Missing", content, nil); err == nil {
+		t.Error("GenerateFileAt with a bad path template succeeded")
+	}
+}
+
+func TestWithMaxTotalSize(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"a.txt": bytes.Repeat([]byte("a"), 40)}, WithMaxTotalSize(100))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	// Overwriting a file only counts its new size.
+	for i := 0; i < 5; i++ {
+		if err := tmp.WriteFile("b.txt", bytes.NewReader(bytes.Repeat([]byte("b"), 50))); err != nil {
+			t.Fatalf("overwrite %d failed: %v", i, err)
+		}
+	}
+	if err := tmp.WriteFile("c.txt", bytes.NewReader(bytes.Repeat([]byte("c"), 20))); err != ErrQuotaExceeded {
+		t.Fatalf("WriteFile past the quota returned %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp.Src, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("file that exceeded the quota was left behind: %v", err)
+	}
+	if err := tmp.WriteSparseFile("sparse.bin", 1<<20, nil); err != ErrQuotaExceeded {
+		t.Errorf("WriteSparseFile past the quota returned %v, want ErrQuotaExceeded", err)
+	}
+	// Shrinking a file frees space for others.
+	if err := tmp.WriteFile("b.txt", strings.NewReader("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmp.WriteFile("c.txt", bytes.NewReader(bytes.Repeat([]byte("c"), 20))); err != nil {
+		t.Errorf("WriteFile within the quota failed: %v", err)
+	}
+	files, err := tmp.ToMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int
+	for _, c := range files {
+		size += len(c)
+	}
+	if size > 100 {
+		t.Errorf("tree grew to %d bytes, past the quota of 100", size)
+	}
+}
+
+func TestWithMaxTotalSizeCountsOtherWriters(t *testing.T) {
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "", mapToSourceFiles(map[string][]byte{
+		"a/a.go": []byte("package a\n"),
+		"b/b.go": []byte("package b\n\nimport _ \"example.com/m/a\"\n"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	cp, err := tmp.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmp.Configure(WithMaxTotalSize(tmp.used + 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmp.Rebase("example.com/m", "example.com/a/much/longer/module/path"); err != ErrQuotaExceeded {
+		t.Errorf("Rebase past the quota returned %v, want ErrQuotaExceeded", err)
+	}
+	err = tmp.Transaction(func(tx *Tx) error {
+		return tx.WriteFile("big.txt", bytes.NewReader(bytes.Repeat([]byte("x"), 20)))
+	})
+	if err != ErrQuotaExceeded {
+		t.Errorf("Transaction past the quota returned %v, want ErrQuotaExceeded", err)
+	}
+	if err := tmp.RevertTo(cp); err != nil {
+		t.Fatalf("RevertTo failed: %v", err)
+	}
+	if err := tmp.AddNestedModule("nested", "example.com/nested", "1.16"); err != ErrQuotaExceeded {
+		t.Errorf("AddNestedModule past the quota returned %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestAddCleanup(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	var order []int
+	for i := 0; i < 3; i++ {
+		i := i
+		tmp.AddCleanup(func() error {
+			order = append(order, i)
+			if i != 1 {
+				return fmt.Errorf("cleanup %d failed", i)
+			}
+			return nil
+		})
+	}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	tmp.Reset()
+	if !reflect.DeepEqual(order, []int{2, 1, 0}) {
+		t.Errorf("cleanups ran in order %v, want [2 1 0]", order)
+	}
+	if got := logged.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, "cleanup 2 failed; cleanup 0 failed") {
+		t.Errorf("errors not logged together, got:\n%s", got)
+	}
+	tmp.Reset()
+	if len(order) != 3 {
+		t.Errorf("cleanups ran again on the second Reset: %v", order)
+	}
+}
+
+func TestWithWalkOrder(t *testing.T) {
+	files := map[string][]byte{"a/x.go": []byte("package a\n"), "a/y.go": []byte("package a\n"), "b.txt": nil, "c.txt": nil}
+	tmp, err := NewTemporaryFromMap("fakegopath", files)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	got, err := tmp.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/x.go", "a/y.go", "b.txt", "c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %v, want lexical order %v", got, want)
+	}
+	if err := tmp.Configure(WithWalkOrder(func(a, b string) bool { return a > b })); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = tmp.Files(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c.txt", "b.txt", "a/y.go", "a/x.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %v, want reverse order %v", got, want)
+	}
+	var walked []string
+	err = tmp.Walk(func(file string) error {
+		walked = append(walked, file)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(walked, got) {
+		t.Errorf("Walk visited %v, want the order of Files %v", walked, got)
+	}
+}
+
+func TestNewTemporaryWithMixedFiles(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "copied.go")
+	if err := ioutil.WriteFile(src, []byte("package p\n\nconst Copied = true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tpl := template.Must(template.New("gen").Parse("package p\n\nconst {{.Name}} = {{.Value}}\n"))
+	tmp, err := NewTemporaryWithFiles("fakegopath", []SourceFile{
+		{Src: src, Dest: "p/copied.go"},
+		{Dest: "p/content.go", Content: []byte("package p\n\nconst Content = true\n")},
+		{Dest: "p/generated.go", Template: tpl, Data: map[string]string{"Name": "Generated", "Value": "true"}},
+		// Template takes precedence over Content, which takes precedence over Src.
+		{Src: src, Dest: "p/both.go", Content: []byte("package p\n\nconst Both = true\n")},
+		{Src: src, Dest: "p/all.go", Content: []byte("not used"), Template: tpl, Data: map[string]string{"Name": "All", "Value": "1"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	tmp.AssertFileEquals(t, "p/copied.go", []byte("package p\n\nconst Copied = true\n"))
+	tmp.AssertFileEquals(t, "p/content.go", []byte("package p\n\nconst Content = true\n"))
+	tmp.AssertFileEquals(t, "p/generated.go", []byte("package p\n\nconst Generated = true\n"))
+	tmp.AssertFileEquals(t, "p/both.go", []byte("package p\n\nconst Both = true\n"))
+	tmp.AssertFileEquals(t, "p/all.go", []byte("package p\n\nconst All = 1\n"))
+	if _, stderr, err := tmp.RunGo("vet", "p"); err != nil {
+		t.Errorf("tree doesn't build: %v\n%s", err, stderr)
+	}
+}
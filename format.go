@@ -0,0 +1,49 @@
+package fakegopath
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FormatAll formats every .go file in the src directory with go/format, rewriting those that change.
+// It returns the slash separated paths of the changed files. Files that fail to parse are left
+// untouched and reported together in the returned error.
+func (t *Temporary) FormatAll() ([]string, error) {
+	var changed, failed []string
+	err := walkFiles(t.Src, func(rel string, _ os.FileInfo) error {
+		if path.Ext(rel) != ".go" {
+			return nil
+		}
+		file := filepath.Join(t.Src, filepath.FromSlash(rel))
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		formatted, err := format.Source(src)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", rel, err))
+			return nil
+		}
+		if bytes.Equal(src, formatted) {
+			return nil
+		}
+		if err := t.WriteFile(filepath.FromSlash(rel), bytes.NewReader(formatted)); err != nil {
+			return err
+		}
+		changed = append(changed, rel)
+		return nil
+	})
+	if err != nil {
+		return changed, err
+	}
+	if len(failed) > 0 {
+		return changed, fmt.Errorf("failed to format:\n%s", strings.Join(failed, "\n"))
+	}
+	return changed, nil
+}
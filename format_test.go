@@ -0,0 +1,32 @@
+package fakegopath
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatAll(t *testing.T) {
+	broken := "package p\n\nfunc {\n"
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"p/formatted.go":   []byte("package p\n\nvar X = 1\n"),
+		"p/unformatted.go": []byte("package p\nvar   Y=2\n"),
+		"p/broken.go":      []byte(broken),
+		"p/notes.txt":      []byte("var   Z=3\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	changed, err := tmp.FormatAll()
+	if err == nil || !strings.Contains(err.Error(), "p/broken.go") {
+		t.Errorf("FormatAll error = %v, want p/broken.go reported", err)
+	}
+	if want := []string{"p/unformatted.go"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %q, want %q", changed, want)
+	}
+	tmp.AssertFileEquals(t, "p/formatted.go", []byte("package p\n\nvar X = 1\n"))
+	tmp.AssertFileEquals(t, "p/unformatted.go", []byte("package p\n\nvar Y = 2\n"))
+	tmp.AssertFileEquals(t, "p/broken.go", []byte(broken))
+	tmp.AssertFileEquals(t, "p/notes.txt", []byte("var   Z=3\n"))
+}
@@ -0,0 +1,36 @@
+package fakegopath
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+)
+
+// WithGoImports makes WriteFile and the functions built on it run .go files through goimports,
+// which must be installed on PATH or in a directory added by AddToPath. Missing imports are
+// added, unused ones removed and the file is formatted.
+func WithGoImports(enable bool) Option {
+	return func(t *Temporary) error {
+		t.goimports = enable
+		return nil
+	}
+}
+
+// runGoImports returns contents fixed by goimports, resolving imports relative to the directory of file.
+func (t *Temporary) runGoImports(file string, contents io.Reader) (io.Reader, error) {
+	bin, err := t.lookPath("goimports")
+	if err != nil {
+		return nil, fmt.Errorf("goimports not found: %v", err)
+	}
+	cmd := exec.Command(bin, "-srcdir", filepath.Dir(filepath.Join(t.Src, file)))
+	cmd.Env = t.Env()
+	cmd.Stdin = contents
+	outBuf, errBuf := bytes.NewBuffer([]byte{}), bytes.NewBuffer([]byte{})
+	cmd.Stdout, cmd.Stderr = outBuf, errBuf
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("goimports failed for %s: %v\n%s", file, err, errBuf)
+	}
+	return outBuf, nil
+}
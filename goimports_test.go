@@ -0,0 +1,122 @@
+package fakegopath
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// stubGoImports is a minimal goimports, built by goImportsDir when the real one isn't installed.
+// It adds imports for the standard packages it knows that a file uses, and formats the file.
+const stubGoImports = `package main
+
+import (
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+var std = map[string]bool{"fmt": true, "os": true, "strings": true}
+
+func main() {
+	src, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		os.Exit(1)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "stdin.go", src, parser.ParseComments)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(1)
+	}
+	imported := map[string]bool{}
+	for _, imp := range f.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		imported[p] = true
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil && std[id.Name] && !imported[id.Name] {
+				imported[id.Name] = true
+				spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(id.Name)}}
+				f.Decls = append([]ast.Decl{&ast.GenDecl{Tok: token.IMPORT, Specs: []ast.Spec{spec}}}, f.Decls...)
+			}
+		}
+		return true
+	})
+	if err := format.Node(os.Stdout, fset, f); err != nil {
+		os.Exit(1)
+	}
+}
+`
+
+// goImportsDir returns a directory to add to PATH so that goimports is found: none if it is installed,
+// otherwise one holding stubGoImports.
+func goImportsDir(t *testing.T) []string {
+	if _, err := exec.LookPath("goimports"); err == nil {
+		return nil
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte(stubGoImports), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "build", "-o", filepath.Join(dir, "goimports"), src)
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build stub goimports: %v\n%s", err, out)
+	}
+	return []string{dir}
+}
+
+func TestWithGoImports(t *testing.T) {
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithGoImports(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	tmp.AddToPath(goImportsDir(t)...)
+	if err := tmp.WriteFile(filepath.Join("p", "p.go"), strings.NewReader("package p\nfunc Hello() string { return fmt.Sprint(\"hello\") }\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	tmp.AssertImports(t, "p", "fmt")
+	if _, stderr, err := tmp.RunGo("build", "p"); err != nil {
+		t.Errorf("generated file doesn't build: %v\n%s", err, stderr)
+	}
+}
+
+func TestWithGoImportsRunsOnGoFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub is a shell script")
+	}
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithGoImports(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	tools := filepath.Join(tmp.Path, "tools")
+	if err := os.Mkdir(tools, 0700); err != nil {
+		t.Fatal(err)
+	}
+	stub := "#!/bin/sh\necho \"// goimports $*\"\ncat\n"
+	if err := ioutil.WriteFile(filepath.Join(tools, "goimports"), []byte(stub), 0700); err != nil {
+		t.Fatal(err)
+	}
+	tmp.AddToPath(tools)
+	if err := tmp.WriteFile(filepath.Join("p", "p.go"), strings.NewReader("package p\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := tmp.WriteFile(filepath.Join("p", "notes.txt"), strings.NewReader("notes\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	tmp.AssertFileEquals(t, filepath.Join("p", "p.go"), []byte("// goimports -srcdir "+filepath.Join(tmp.Src, "p")+"\npackage p\n"))
+	tmp.AssertFileEquals(t, filepath.Join("p", "notes.txt"), []byte("notes\n"))
+}
@@ -0,0 +1,168 @@
+package fakegopath
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// goPaths is the ordered list of temporary trees prefixed to the GOPATH that was in effect when
+// the first of them was added. Entries are kept newest first.
+var goPaths struct {
+	sync.Mutex
+	entries []string
+	base    string
+}
+
+// goPathLock serialises use of the global GOPATH between goroutines. See GoPathLock.
+var goPathLock sync.Mutex
+
+// GoPathLock acquires exclusive use of the global GOPATH, blocking until it is available.
+// Parallel tests that create temporaries which update GOPATH should hold the lock from creation
+// until after Reset, so that each only sees its own tree in GOPATH:
+//
+//	fakegopath.GoPathLock()
+//	defer fakegopath.GoPathUnlock()
+//	t, err := fakegopath.NewTemporaryWithFiles("test", files)
+//	...
+//	defer t.Reset()
+func GoPathLock() { goPathLock.Lock() }
+
+// GoPathUnlock releases the lock acquired by GoPathLock.
+func GoPathUnlock() { goPathLock.Unlock() }
+
+// addGoPath prefixes dir to GOPATH, keeping any entries added by other temporaries after it.
+func addGoPath(dir string) {
+	goPaths.Lock()
+	defer goPaths.Unlock()
+	if len(goPaths.entries) == 0 {
+		goPaths.base = build.Default.GOPATH
+	}
+	goPaths.entries = append([]string{dir}, goPaths.entries...)
+	setGoPath()
+}
+
+// removeGoPath removes dir from GOPATH, leaving the relative order of the remaining entries intact.
+// The original GOPATH is restored once the last entry is removed.
+func removeGoPath(dir string) {
+	goPaths.Lock()
+	defer goPaths.Unlock()
+	for i, e := range goPaths.entries {
+		if e == dir {
+			goPaths.entries = append(goPaths.entries[:i], goPaths.entries[i+1:]...)
+			break
+		}
+	}
+	setGoPath()
+}
+
+func setGoPath() {
+	p := goPaths.base
+	if len(goPaths.entries) > 0 {
+		p = joinList(append(append([]string{}, goPaths.entries...), goPaths.base)...)
+	}
+	build.Default.GOPATH = p
+	os.Setenv("GOPATH", p)
+}
+
+// BuildContext returns a copy of go.build.Default whose GOPATH includes the tree, with any
+// changes made by WithBuildContext applied. It does not depend on whether the tree updated the global GOPATH.
+// For GOPATH-style trees JoinPath is set, which stops Import from delegating to the go command, so that
+// packages are found in GOPATH whatever the value of GO111MODULE.
+func (t *Temporary) BuildContext() build.Context {
+	ctx := build.Default
+	ctx.GOPATH = t.goPath()
+	if !t.IsModule() {
+		ctx.JoinPath = filepath.Join
+	}
+	for _, fn := range t.ctxFuncs {
+		fn(&ctx)
+	}
+	return ctx
+}
+
+// WithBuildContext records fn as a change to the context returned by BuildContext, e.g. to set BuildTags.
+// If the tree updates the global GOPATH, fn is also applied to go.build.Default until Reset. Changes made
+// by several trees are applied in the order they were made, and removing one leaves the others in place.
+// Changes made by fn to GOPATH in go.build.Default are ignored, since GOPATH is managed separately.
+func WithBuildContext(fn func(*build.Context)) Option {
+	return func(t *Temporary) error {
+		t.ctxFuncs = append(t.ctxFuncs, fn)
+		if t.update {
+			addBuildContext(t, fn)
+		}
+		return nil
+	}
+}
+
+// buildContexts is the ordered list of changes made to go.build.Default by WithBuildContext, which are
+// applied in order to the context that was in effect when the first of them was made.
+var buildContexts struct {
+	sync.Mutex
+	changes []contextChange
+	base    build.Context
+}
+
+type contextChange struct {
+	owner *Temporary
+	fn    func(*build.Context)
+}
+
+func addBuildContext(t *Temporary, fn func(*build.Context)) {
+	buildContexts.Lock()
+	defer buildContexts.Unlock()
+	if len(buildContexts.changes) == 0 {
+		buildContexts.base = build.Default
+	}
+	buildContexts.changes = append(buildContexts.changes, contextChange{owner: t, fn: fn})
+	setBuildContext()
+}
+
+// removeBuildContext undoes the changes made by t, keeping those made by other trees.
+// The original context is restored once the last change is removed.
+func removeBuildContext(t *Temporary) {
+	buildContexts.Lock()
+	defer buildContexts.Unlock()
+	kept := buildContexts.changes[:0]
+	for _, c := range buildContexts.changes {
+		if c.owner != t {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == len(buildContexts.changes) {
+		return
+	}
+	buildContexts.changes = kept
+	setBuildContext()
+}
+
+func setBuildContext() {
+	ctx := buildContexts.base
+	for _, c := range buildContexts.changes {
+		c.fn(&ctx)
+	}
+	ctx.GOPATH = build.Default.GOPATH
+	build.Default = ctx
+}
+
+// goPath returns the GOPATH for the tree. For trees that update the global GOPATH and module-style
+// trees this is the current global value, otherwise the tree is prefixed to it.
+func (t *Temporary) goPath() string {
+	if t.update || t.IsModule() {
+		return build.Default.GOPATH
+	}
+	return joinList(t.canonical, build.Default.GOPATH)
+}
+
+// joinList joins the non-empty elements of paths with the OS path list separator.
+func joinList(paths ...string) string {
+	nonEmpty := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, string(filepath.ListSeparator))
+}
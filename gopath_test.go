@@ -0,0 +1,177 @@
+package fakegopath
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResetKeepsGoPathOrder(t *testing.T) {
+	orig := build.Default.GOPATH
+	var trees []*Temporary
+	for i := 0; i < 3; i++ {
+		tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+		if err != nil {
+			t.Fatalf("failed to create tree %d: %v", i, err)
+		}
+		defer tmp.Reset()
+		trees = append(trees, tmp)
+	}
+	trees[1].Reset()
+
+	want := append([]string{trees[2].canonical, trees[0].canonical}, filepath.SplitList(orig)...)
+	if got := filepath.SplitList(build.Default.GOPATH); !reflect.DeepEqual(got, want) {
+		t.Errorf("GOPATH after resetting the middle tree = %q, want %q", got, want)
+	}
+	if env := os.Getenv("GOPATH"); env != build.Default.GOPATH {
+		t.Errorf("GOPATH env = %s, want %s", env, build.Default.GOPATH)
+	}
+
+	trees[0].Reset()
+	trees[2].Reset()
+	if build.Default.GOPATH != orig {
+		t.Errorf("GOPATH after resetting all trees = %s, want %s", build.Default.GOPATH, orig)
+	}
+}
+
+func TestBuildContextWithoutGoPathUpdate(t *testing.T) {
+	// The go command ignores GOPATH in module mode, so BuildContext must not defer to it.
+	t.Setenv("GO111MODULE", "on")
+	tmp, err := newTemporaryWithFiles("fakegopath", mapToSourceFiles(map[string][]byte{
+		"p/p.go": []byte("package p\n"),
+	}), func(dir string) (*Temporary, error) { return NewTemporary(dir, false) })
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		if p == tmp.canonical {
+			t.Fatalf("non-mutating tree was added to GOPATH %s", build.Default.GOPATH)
+		}
+	}
+	ctx := tmp.BuildContext()
+	pkg, err := ctx.Import("p", "", 0)
+	if err != nil {
+		t.Fatalf("failed to import p: %v", err)
+	}
+	if want := filepath.Join(tmp.canonical, "src", "p"); pkg.Dir != want {
+		t.Errorf("p resolved to %s, want %s", pkg.Dir, want)
+	}
+}
+
+func TestGoPathLock(t *testing.T) {
+	base := filepath.SplitList(build.Default.GOPATH)
+	for _, name := range []string{"a", "b"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			GoPathLock()
+			defer GoPathUnlock()
+			tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+			if err != nil {
+				t.Fatalf("failed to create tree: %v", err)
+			}
+			defer tmp.Reset()
+			for i := 0; i < 10; i++ {
+				want := append([]string{tmp.canonical}, base...)
+				if got := filepath.SplitList(build.Default.GOPATH); !reflect.DeepEqual(got, want) {
+					t.Fatalf("GOPATH = %q, want %q", got, want)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestSymlinkedTree(t *testing.T) {
+	base := t.TempDir()
+	real, link := filepath.Join(base, "real"), filepath.Join(base, "link")
+	if err := os.Mkdir(real, 0700); err != nil {
+		t.Fatalf("failed to create %s: %v", real, err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	tmp, err := NewTemporary(filepath.Join(link, "tree"), true)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.WriteFile(filepath.Join("p", "p.go"), strings.NewReader("package p\n")); err != nil {
+		t.Fatalf("failed to write p: %v", err)
+	}
+	canonical, err := filepath.EvalSymlinks(filepath.Join(link, "tree"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.SplitList(build.Default.GOPATH)[0]; got != canonical {
+		t.Errorf("GOPATH starts with %s, want %s", got, canonical)
+	}
+	ctx := tmp.BuildContext()
+	if _, err := ctx.Import("p", "", 0); err != nil {
+		t.Errorf("failed to import p: %v", err)
+	}
+	if _, stderr, err := tmp.RunGo("build", "p"); err != nil {
+		t.Errorf("failed to build p: %v\n%s", err, stderr)
+	}
+}
+
+func addTag(tag string) Option {
+	return WithBuildContext(func(ctx *build.Context) { ctx.BuildTags = append(ctx.BuildTags, tag) })
+}
+
+func TestWithBuildContextSelectsTaggedFile(t *testing.T) {
+	orig := build.Default.BuildTags
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"p/custom.go": []byte("//go:build custom\n\npackage p\n"),
+		"p/other.go":  []byte("//go:build !custom\n\npackage p\n"),
+	}, addTag("custom"))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	ctx := tmp.BuildContext()
+	pkg, err := ctx.Import("p", "", 0)
+	if err != nil {
+		t.Fatalf("failed to import p: %v", err)
+	}
+	if want := []string{"custom.go"}; !reflect.DeepEqual(pkg.GoFiles, want) {
+		t.Errorf("GoFiles = %q, want %q", pkg.GoFiles, want)
+	}
+	if want := append(append([]string{}, orig...), "custom"); !reflect.DeepEqual(build.Default.BuildTags, want) {
+		t.Errorf("global BuildTags = %q, want %q", build.Default.BuildTags, want)
+	}
+	tmp.Reset()
+	if !reflect.DeepEqual(build.Default.BuildTags, orig) {
+		t.Errorf("BuildTags after Reset = %q, want %q", build.Default.BuildTags, orig)
+	}
+}
+
+func TestWithBuildContextStacking(t *testing.T) {
+	orig := build.Default.BuildTags
+	a, err := NewTemporaryWithFiles("fakegopath", nil, addTag("a"))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer a.Reset()
+	b, err := NewTemporaryWithFiles("fakegopath", nil, addTag("b"))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer b.Reset()
+
+	a.Reset()
+	if want := append(append([]string{}, orig...), "b"); !reflect.DeepEqual(build.Default.BuildTags, want) {
+		t.Errorf("BuildTags after resetting the first tree = %q, want %q", build.Default.BuildTags, want)
+	}
+	b.Reset()
+	if !reflect.DeepEqual(build.Default.BuildTags, orig) {
+		t.Errorf("BuildTags after resetting both trees = %q, want %q", build.Default.BuildTags, orig)
+	}
+	if strings.Contains(build.Default.GOPATH, a.canonical) || strings.Contains(build.Default.GOPATH, b.canonical) {
+		t.Errorf("GOPATH not restored: %s", build.Default.GOPATH)
+	}
+}
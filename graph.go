@@ -0,0 +1,82 @@
+package fakegopath
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportGraph parses the non-test .go files in the tree and returns the import path of each package
+// mapped to the sorted import paths it imports. Directories ignored by the go tool are skipped.
+func (t *Temporary) ImportGraph() (map[string][]string, error) {
+	imports := map[string]map[string]bool{}
+	fset := token.NewFileSet()
+	err := walkFiles(t.Src, func(rel string, _ os.FileInfo) error {
+		if path.Ext(rel) != ".go" || strings.HasSuffix(rel, "_test.go") || ignoredByGo(rel) {
+			return nil
+		}
+		file := filepath.Join(t.Src, filepath.FromSlash(rel))
+		f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", file, err)
+		}
+		pkg := t.ImportPath(path.Dir(rel))
+		if imports[pkg] == nil {
+			imports[pkg] = map[string]bool{}
+		}
+		for _, imp := range f.Imports {
+			if p, err := strconv.Unquote(imp.Path.Value); err == nil {
+				imports[pkg][p] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	graph := make(map[string][]string, len(imports))
+	for pkg, imps := range imports {
+		graph[pkg] = []string{}
+		for p := range imps {
+			graph[pkg] = append(graph[pkg], p)
+		}
+		sort.Strings(graph[pkg])
+	}
+	return graph, nil
+}
+
+// Importers returns the sorted import paths of the packages in the tree that import importPath.
+func (t *Temporary) Importers(importPath string) ([]string, error) {
+	graph, err := t.ImportGraph()
+	if err != nil {
+		return nil, err
+	}
+	var importers []string
+	for pkg, imps := range graph {
+		for _, p := range imps {
+			if p == importPath {
+				importers = append(importers, pkg)
+				break
+			}
+		}
+	}
+	sort.Strings(importers)
+	return importers, nil
+}
+
+// ignoredByGo returns true if the slash separated path rel is in a directory the go tool ignores.
+func ignoredByGo(rel string) bool {
+	dirs := strings.Split(rel, "/")
+	for _, d := range dirs[:len(dirs)-1] {
+		if strings.HasPrefix(d, ".") || strings.HasPrefix(d, "_") || d == "testdata" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package fakegopath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImporters(t *testing.T) {
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "", mapToSourceFiles(map[string][]byte{
+		"base/base.go":       []byte("package base\n"),
+		"a/a.go":             []byte("package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/m/base\"\n)\n"),
+		"b/b.go":             []byte("package b\n\nimport _ \"example.com/m/base\"\n"),
+		"c/c.go":             []byte("package c\n\nimport _ \"example.com/m/a\"\n"),
+		"d/d_test.go":        []byte("package d\n\nimport _ \"example.com/m/base\"\n"),
+		"testdata/t/t.go":    []byte("package t\n\nimport _ \"example.com/m/base\"\n"),
+		"_ignored/ignore.go": []byte("package ignored\n\nimport _ \"example.com/m/base\"\n"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	for importPath, want := range map[string][]string{
+		"example.com/m/base": {"example.com/m/a", "example.com/m/b"},
+		"example.com/m/a":    {"example.com/m/c"},
+		"fmt":                {"example.com/m/a"},
+		"example.com/m/c":    nil,
+	} {
+		got, err := tmp.Importers(importPath)
+		if err != nil {
+			t.Fatalf("Importers(%s) failed: %v", importPath, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Importers(%s) = %v, want %v", importPath, got, want)
+		}
+	}
+}
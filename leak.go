@@ -0,0 +1,78 @@
+package fakegopath
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// leaks tracks temporaries that have not been Reset, once RegisterLeakCheck has been called.
+var leaks struct {
+	sync.Mutex
+	enabled bool
+	active  map[*Temporary]bool
+}
+
+// RegisterLeakCheck starts tracking temporaries so that CheckLeaks can report those that were never Reset.
+// It is typically called from TestMain along with CheckLeaks, after ResetShared so that trees from
+// FreezeShared are not reported:
+//
+//	func TestMain(m *testing.M) {
+//		fakegopath.RegisterLeakCheck()
+//		code := m.Run()
+//		fakegopath.ResetShared()
+//		if err := fakegopath.CheckLeaks(); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			code = 1
+//		}
+//		os.Exit(code)
+//	}
+func RegisterLeakCheck() {
+	leaks.Lock()
+	defer leaks.Unlock()
+	leaks.enabled = true
+	if leaks.active == nil {
+		leaks.active = map[*Temporary]bool{}
+	}
+}
+
+// CheckLeaks returns an error listing temporaries created since RegisterLeakCheck that are still active,
+// and the GOPATH if it has not been restored.
+func CheckLeaks() error {
+	leaks.Lock()
+	paths := make([]string, 0, len(leaks.active))
+	for t := range leaks.active {
+		paths = append(paths, t.Path)
+	}
+	leaks.Unlock()
+	sort.Strings(paths)
+
+	var msgs []string
+	if len(paths) > 0 {
+		msgs = append(msgs, fmt.Sprintf("temporaries not reset: %s", strings.Join(paths, ", ")))
+	}
+	goPaths.Lock()
+	if len(goPaths.entries) > 0 {
+		msgs = append(msgs, fmt.Sprintf("GOPATH not restored, still contains: %s", strings.Join(goPaths.entries, ", ")))
+	}
+	goPaths.Unlock()
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("fakegopath: %s", strings.Join(msgs, "; "))
+}
+
+func trackTemporary(t *Temporary) {
+	leaks.Lock()
+	defer leaks.Unlock()
+	if leaks.enabled {
+		leaks.active[t] = true
+	}
+}
+
+func untrackTemporary(t *Temporary) {
+	leaks.Lock()
+	defer leaks.Unlock()
+	delete(leaks.active, t)
+}
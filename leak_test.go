@@ -0,0 +1,23 @@
+package fakegopath
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckLeaks(t *testing.T) {
+	RegisterLeakCheck()
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	err = CheckLeaks()
+	if err == nil || !strings.Contains(err.Error(), tmp.Path) || !strings.Contains(err.Error(), "GOPATH not restored") {
+		t.Errorf("CheckLeaks with an active tree = %v, want it and GOPATH reported", err)
+	}
+	tmp.Reset()
+	if err := CheckLeaks(); err != nil && (strings.Contains(err.Error(), tmp.Path) || strings.Contains(err.Error(), tmp.canonical)) {
+		t.Errorf("CheckLeaks after Reset = %v, want %s not reported", err, tmp.Path)
+	}
+}
@@ -0,0 +1,55 @@
+package fakegopath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"text/template"
+)
+
+// manifestEntry is a single file in a manifest rendered by BuildFromManifestTemplate.
+type manifestEntry struct {
+	Dest    string `json:"dest"`    // The slash separated path relative to the src directory.
+	Src     string `json:"src"`     // The file to copy, if set.
+	Content string `json:"content"` // The contents of the file, if Src is not set.
+}
+
+// BuildFromManifestTemplate creates a temporary go source tree, as NewTemporaryWithFiles does, from a manifest
+// produced by executing manifestTpl against data. The manifest is a JSON array of objects with a "dest" path
+// and either a "src" file to copy or the file's "content". The template function json escapes a value for use
+// inside a JSON string, e.g.
+//
+//	[{"dest": "{{json .Pkg}}/{{json .Pkg}}.go", "content": "package {{json .Pkg}}\n"}]
+func BuildFromManifestTemplate(manifestTpl string, data interface{}) (*Temporary, error) {
+	tpl, err := template.New("manifest").Funcs(template.FuncMap{"json": jsonEscape}).Parse(manifestTpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest template: %v", err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := tpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("failed to generate manifest: %v", err)
+	}
+	var entries []manifestEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %v\n%s", err, buf)
+	}
+	files := make([]SourceFile, 0, len(entries))
+	for _, e := range entries {
+		f := SourceFile{Dest: filepath.FromSlash(e.Dest), Src: e.Src}
+		if e.Src == "" {
+			f.Content = []byte(e.Content)
+		}
+		files = append(files, f)
+	}
+	return NewTemporaryWithFiles("fakegopath", files)
+}
+
+// jsonEscape returns s encoded as a JSON string, without the surrounding quotes.
+func jsonEscape(s string) (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b[1 : len(b)-1]), nil
+}
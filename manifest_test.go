@@ -0,0 +1,30 @@
+package fakegopath
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildFromManifestTemplate(t *testing.T) {
+	manifest := `[
+		{"dest": "{{json .Pkg}}/{{json .Pkg}}.go", "content": "package {{json .Pkg}}\n\n// {{json .Greeting}}\n"}
+	]`
+	for _, data := range []struct{ Pkg, Greeting string }{
+		{"hello", `say "hi" \ <wave>`},
+		{"goodbye", "wave"},
+	} {
+		tmp, err := BuildFromManifestTemplate(manifest, data)
+		if err != nil {
+			t.Fatalf("BuildFromManifestTemplate failed: %v", err)
+		}
+		defer tmp.Reset()
+		tmp.AssertFileEquals(t, filepath.Join(data.Pkg, data.Pkg+".go"), []byte("package "+data.Pkg+"\n\n// "+data.Greeting+"\n"))
+		if _, stderr, err := tmp.RunGo("vet", data.Pkg); err != nil {
+			t.Errorf("generated tree doesn't build: %v\n%s", err, stderr)
+		}
+	}
+
+	if _, err := BuildFromManifestTemplate(`[{"dest": "{{.Pkg}}"`, struct{ Pkg string }{"p"}); err == nil {
+		t.Error("malformed manifest accepted")
+	}
+}
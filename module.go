@@ -0,0 +1,309 @@
+package fakegopath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NewTemporaryModule creates a module-style temporary under dir, with a go.mod declaring modulePath.
+// Files are written relative to the module root, which is dir, and GOPATH is left untouched.
+// goVersion is used for the go directive in go.mod, which is omitted if goVersion is empty.
+// Bin is a .bin directory in the module root, which the go tool ignores. opts are applied after go.mod is written.
+func NewTemporaryModule(dir, modulePath, goVersion string, opts ...Option) (*Temporary, error) {
+	t := &Temporary{
+		Path:   dir,
+		Orig:   build.Default.GOPATH,
+		Src:    dir,
+		Bin:    filepath.Join(dir, ".bin"),
+		module: modulePath,
+		goLog:  &commandLog{},
+	}
+	if err := t.mkdirs(t.Src, t.Bin); err != nil {
+		return nil, err
+	}
+	if err := t.writeGoMod(t.Src, modulePath, goVersion); err != nil {
+		return nil, err
+	}
+	trackTemporary(t)
+	if err := t.Configure(opts...); err != nil {
+		t.Reset()
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewTemporaryModuleWithFiles creates a module-style temporary after copying/creating files.
+// prefix is used to create a temporary directory which is the module root.
+func NewTemporaryModuleWithFiles(prefix, modulePath, goVersion string, files []SourceFile, opts ...Option) (*Temporary, error) {
+	return newTemporaryWithFiles(prefix, files, func(dir string) (*Temporary, error) {
+		return NewTemporaryModule(dir, modulePath, goVersion, opts...)
+	})
+}
+
+// WithModuleSubdir places the module root of a module-style tree at rel, a directory relative to Path,
+// so that tools which walk up to find go.mod can be tested. Root and the paths passed to WriteFile and
+// friends are then relative to the new module root. Pass it to NewTemporaryModule or
+// NewTemporaryModuleWithFiles; it fails if the module root already holds anything other than go.mod.
+func WithModuleSubdir(rel string) Option {
+	return func(t *Temporary) error {
+		if !t.IsModule() {
+			return fmt.Errorf("%s is not a module-style tree", t.Path)
+		}
+		infos, err := ioutil.ReadDir(t.Src)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", t.Src, err)
+		}
+		for _, info := range infos {
+			if info.Name() != "go.mod" && filepath.Join(t.Src, info.Name()) != t.Bin {
+				return fmt.Errorf("cannot move module root of %s containing %s", t.Path, info.Name())
+			}
+		}
+		root := filepath.Join(t.Path, rel)
+		if err := os.MkdirAll(root, 0700); err != nil {
+			return fmt.Errorf("failed to create %s: %v", root, err)
+		}
+		if err := os.Rename(filepath.Join(t.Src, "go.mod"), filepath.Join(root, "go.mod")); err != nil {
+			return fmt.Errorf("failed to move go.mod to %s: %v", root, err)
+		}
+		t.Src = root
+		return nil
+	}
+}
+
+// IsModule returns true for module-style trees and false for GOPATH-style trees.
+func (t *Temporary) IsModule() bool { return t.module != "" }
+
+// ModulePath returns the module path of a module-style tree, or "" for a GOPATH-style tree.
+func (t *Temporary) ModulePath() string { return t.module }
+
+// Root returns the directory that file paths passed to WriteFile and friends are relative to.
+// This is the src directory for GOPATH-style trees and the module root for module-style trees.
+func (t *Temporary) Root() string { return t.Src }
+
+// ImportPath returns the import path of the package in dir, a path relative to Root.
+// In module-style trees, dir is resolved against the innermost module containing it.
+func (t *Temporary) ImportPath(dir string) string {
+	rel := filepath.ToSlash(filepath.Clean(dir))
+	if rel == "." {
+		rel = ""
+	}
+	if !t.IsModule() {
+		return rel
+	}
+	root, module := t.moduleFor(rel)
+	return path.Join(module, strings.TrimPrefix(strings.TrimPrefix(rel, root), "/"))
+}
+
+// PackageDir returns the absolute directory in the tree of the package with importPath.
+// It is the inverse of ImportPath, and returns an error if the directory does not exist.
+func (t *Temporary) PackageDir(importPath string) (string, error) {
+	rel, ok := importPath, !t.IsModule()
+	if t.IsModule() {
+		modules := map[string]string{"": t.module}
+		for r, m := range t.nested {
+			modules[r] = m
+		}
+		best := ""
+		for r, m := range modules {
+			if (importPath == m || strings.HasPrefix(importPath, m+"/")) && len(m) >= len(best) {
+				best, rel, ok = m, path.Join(r, strings.TrimPrefix(importPath, m)), true
+			}
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is not in module %s", importPath, t.module)
+	}
+	dir := filepath.Join(t.Src, filepath.FromSlash(rel))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("no directory for %s in %s", importPath, t.Src)
+	}
+	return dir, nil
+}
+
+// AddNestedModule adds a module with modulePath rooted at dir, a path relative to Root, to a module-style tree.
+// goVersion is used for the go directive as in NewTemporaryModule. Packages under dir belong to the nested
+// module, which is built separately from the enclosing one, e.g. with RunGoIn.
+func (t *Temporary) AddNestedModule(dir, modulePath, goVersion string) error {
+	if !t.IsModule() {
+		return fmt.Errorf("%s is not a module-style tree", t.Path)
+	}
+	root := filepath.Join(t.Src, dir)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %v", root, err)
+	}
+	if err := t.writeGoMod(root, modulePath, goVersion); err != nil {
+		return err
+	}
+	if t.nested == nil {
+		t.nested = map[string]string{}
+	}
+	t.nested[filepath.ToSlash(filepath.Clean(dir))] = modulePath
+	return nil
+}
+
+// moduleFor returns the root, relative to Root, and path of the innermost module containing rel.
+func (t *Temporary) moduleFor(rel string) (root, module string) {
+	module = t.module
+	for r, m := range t.nested {
+		if (rel == r || strings.HasPrefix(rel, r+"/")) && len(r) > len(root) {
+			root, module = r, m
+		}
+	}
+	return root, module
+}
+
+func (t *Temporary) writeGoMod(dir, modulePath, goVersion string) error {
+	contents := fmt.Sprintf("module %s\n", modulePath)
+	if goVersion != "" {
+		contents += fmt.Sprintf("\ngo %s\n", goVersion)
+	}
+	file := filepath.Join(dir, "go.mod")
+	if err := t.writeInPlace(file, []byte(contents), 0600); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rebase changes the module path of a module-style tree from oldModule to newModule, rewriting the
+// module directive in go.mod and every import of oldModule or its packages in the tree's .go files.
+func (t *Temporary) Rebase(oldModule, newModule string) error {
+	if !t.IsModule() {
+		return fmt.Errorf("%s is not a module-style tree", t.Path)
+	}
+	if err := t.rebaseGoMod(filepath.Join(t.Src, "go.mod"), oldModule, newModule); err != nil {
+		return err
+	}
+	err := walkFiles(t.Src, func(rel string, info os.FileInfo) error {
+		if filepath.Ext(rel) != ".go" {
+			return nil
+		}
+		return t.rebaseImports(filepath.Join(t.Src, filepath.FromSlash(rel)), info.Mode(), oldModule, newModule)
+	})
+	if err != nil {
+		return err
+	}
+	if t.module == oldModule {
+		t.module = newModule
+	}
+	return nil
+}
+
+func (t *Temporary) rebaseGoMod(file, oldModule, newModule string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	lines := strings.Split(string(b), "\n")
+	for i, l := range lines {
+		if f := strings.Fields(l); len(f) == 2 && f[0] == "module" && strings.Trim(f[1], `"`) == oldModule {
+			lines[i] = "module " + newModule
+			return t.writeInPlace(file, []byte(strings.Join(lines, "\n")), 0600)
+		}
+	}
+	return fmt.Errorf("%s does not declare module %s", file, oldModule)
+}
+
+// rebaseImports rewrites import paths in file in place, leaving the rest of the file untouched.
+func (t *Temporary) rebaseImports(file string, mode os.FileMode, oldModule, newModule string) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, parser.ImportsOnly)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", file, err)
+	}
+	changed := false
+	// Replace from the end so that earlier offsets remain valid.
+	for i := len(f.Imports) - 1; i >= 0; i-- {
+		lit := f.Imports[i].Path
+		p, err := strconv.Unquote(lit.Value)
+		if err != nil || (p != oldModule && !strings.HasPrefix(p, oldModule+"/")) {
+			continue
+		}
+		start := fset.Position(lit.Pos()).Offset
+		end := start + len(lit.Value)
+		quoted := strconv.Quote(newModule + strings.TrimPrefix(p, oldModule))
+		src = append(src[:start], append([]byte(quoted), src[end:]...)...)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return t.writeInPlace(file, src, mode)
+}
+
+// writeInPlace writes contents to file, a full path in the src directory, like ioutil.WriteFile,
+// counting the change in size towards WithMaxTotalSize.
+func (t *Temporary) writeInPlace(file string, contents []byte, mode os.FileMode) error {
+	old := fileSize(file)
+	if err := t.reserve(old, int64(len(contents))); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, contents, mode); err != nil {
+		t.used += fileSize(file) - int64(len(contents))
+		return fmt.Errorf("failed to write %s: %v", file, err)
+	}
+	return nil
+}
+
+// goModRequires returns the module paths required by the go.mod file, mapped to their versions.
+// Both single line and block forms of the require directive are understood.
+func goModRequires(file string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	reqs := map[string]string{}
+	inBlock := false
+	for _, l := range strings.Split(string(b), "\n") {
+		if i := strings.Index(l, "//"); i >= 0 {
+			l = l[:i]
+		}
+		f := strings.Fields(l)
+		switch {
+		case inBlock && len(f) == 1 && f[0] == ")":
+			inBlock = false
+		case inBlock && len(f) == 2:
+			reqs[strings.Trim(f[0], `"`)] = f[1]
+		case len(f) == 2 && f[0] == "require" && f[1] == "(":
+			inBlock = true
+		case len(f) == 3 && f[0] == "require":
+			reqs[strings.Trim(f[1], `"`)] = f[2]
+		}
+	}
+	return reqs, nil
+}
+
+// ImportModuleVersion copies the files of version of the module modulePath into dest, a path relative to the src
+// directory, using CopyDir. The module is downloaded into the module cache with go mod download if needed.
+func (t *Temporary) ImportModuleVersion(modulePath, version, dest string) error {
+	args := []string{"mod", "download", "-json", modulePath + "@" + version}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = t.Src
+	cmd.Env = setEnv(t.Env(), "GO111MODULE", "on")
+	outBuf, errBuf := bytes.NewBuffer([]byte{}), bytes.NewBuffer([]byte{})
+	cmd.Stdout, cmd.Stderr = outBuf, errBuf
+	runErr := cmd.Run()
+	t.logGo(args, outBuf.String()+errBuf.String())
+	var mod struct {
+		Dir   string
+		Error string
+	}
+	if err := json.Unmarshal(outBuf.Bytes(), &mod); err != nil || mod.Error != "" || mod.Dir == "" {
+		return fmt.Errorf("failed to download %s@%s: %v %s\n%s", modulePath, version, runErr, mod.Error, errBuf)
+	}
+	return t.CopyDir(dest, mod.Dir)
+}
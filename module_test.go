@@ -0,0 +1,225 @@
+package fakegopath
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsModule(t *testing.T) {
+	constructors := []struct {
+		name   string
+		create func(dir string) (*Temporary, error)
+		module string
+	}{
+		{"NewTemporary", func(dir string) (*Temporary, error) { return NewTemporary(dir, false) }, ""},
+		{"NewTemporaryWithFiles", func(string) (*Temporary, error) { return NewTemporaryWithFiles("fakegopath", nil) }, ""},
+		{"NewTemporaryFromMap", func(string) (*Temporary, error) { return NewTemporaryFromMap("fakegopath", nil) }, ""},
+		{"NewTemporaryModule", func(dir string) (*Temporary, error) { return NewTemporaryModule(dir, "example.com/m", "") }, "example.com/m"},
+		{"NewTemporaryModuleWithFiles", func(string) (*Temporary, error) {
+			return NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "1.16", nil)
+		}, "example.com/m"},
+	}
+	for _, c := range constructors {
+		t.Run(c.name, func(t *testing.T) {
+			tmp, err := c.create(t.TempDir())
+			if err != nil {
+				t.Fatalf("failed to create tree: %v", err)
+			}
+			defer tmp.Reset()
+			if got, want := tmp.IsModule(), c.module != ""; got != want {
+				t.Errorf("IsModule = %v, want %v", got, want)
+			}
+			if got := tmp.ModulePath(); got != c.module {
+				t.Errorf("ModulePath = %q, want %q", got, c.module)
+			}
+		})
+	}
+}
+
+func TestRebase(t *testing.T) {
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/old", "1.16", mapToSourceFiles(map[string][]byte{
+		"a/a.go":      []byte("package a\n\nconst Name = \"example.com/old/a\"\n"),
+		"cmd/main.go": []byte("package main\n\nimport \"example.com/old/a\"\n\nfunc main() { println(a.Name) }\n"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.Rebase("example.com/old", "example.com/new"); err != nil {
+		t.Fatalf("Rebase failed: %v", err)
+	}
+	if got := tmp.ModulePath(); got != "example.com/new" {
+		t.Errorf("ModulePath = %s, want example.com/new", got)
+	}
+	if _, stderr, err := tmp.RunGo("build", "./..."); err != nil {
+		t.Fatalf("rebased tree doesn't build: %v\n%s", err, stderr)
+	}
+	tmp.AssertImports(t, "cmd", "example.com/new/a")
+	// Only imports are rewritten, not other occurrences of the module path.
+	tmp.AssertFileMatches(t, "a/a.go", `"example.com/old/a"`)
+}
+
+func TestWithModuleSubdir(t *testing.T) {
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "1.16", mapToSourceFiles(map[string][]byte{
+		"a/b/b.go": []byte("package b\n"),
+	}), WithModuleSubdir(filepath.Join("work", "mod")))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	root := filepath.Join(tmp.Path, "work", "mod")
+	if tmp.Root() != root {
+		t.Errorf("Root = %s, want %s", tmp.Root(), root)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a", "b", "b.go")); err != nil {
+		t.Errorf("file was not written under the module root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp.Path, "go.mod")); !os.IsNotExist(err) {
+		t.Errorf("go.mod left in the temp dir: %v", err)
+	}
+	// The go tool finds go.mod by walking up from a package directory.
+	stdout, stderr, err := tmp.RunGoIn(filepath.Join("a", "b"), "env", "GOMOD")
+	if err != nil {
+		t.Fatalf("go env failed: %v\n%s", err, stderr)
+	}
+	if got, want := strings.TrimSpace(stdout), filepath.Join(tmp.canonical, "work", "mod", "go.mod"); got != want {
+		t.Errorf("GOMOD = %s, want %s", got, want)
+	}
+	if err := tmp.Configure(WithModuleSubdir("elsewhere")); err == nil {
+		t.Error("moving the module root after files were written succeeded")
+	}
+
+	gopath, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer gopath.Reset()
+	if err := gopath.Configure(WithModuleSubdir("mod")); err == nil {
+		t.Error("WithModuleSubdir succeeded for a GOPATH-style tree")
+	}
+}
+
+func TestAddNestedModule(t *testing.T) {
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/root", "1.16", mapToSourceFiles(map[string][]byte{
+		"a/a.go":             []byte("package a\n"),
+		"nested/n.go":        []byte("package nested\n"),
+		"nested/sub/sub.go":  []byte("package sub\n"),
+		"nested/cmd/main.go": []byte("package main\n\nimport \"example.com/nested/sub\"\n\nvar _ = sub.X\n\nfunc main() {}\n"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.AddNestedModule("nested", "example.com/nested", "1.16"); err != nil {
+		t.Fatalf("AddNestedModule failed: %v", err)
+	}
+	if err := tmp.WriteFile("nested/sub/x.go", strings.NewReader("package sub\n\nconst X = 1\n")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if got := tmp.ImportPath("nested/sub"); got != "example.com/nested/sub" {
+		t.Errorf("ImportPath(nested/sub) = %s, want example.com/nested/sub", got)
+	}
+	// Each module builds on its own, and the root module doesn't contain the nested one.
+	stdout, stderr, err := tmp.RunGo("list", "./...")
+	if err != nil {
+		t.Fatalf("go list failed in the root module: %v\n%s", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "example.com/root/a" {
+		t.Errorf("root module lists:\n%s\nwant only example.com/root/a", stdout)
+	}
+	if _, stderr, err := tmp.RunGo("build", "./..."); err != nil {
+		t.Errorf("root module doesn't build: %v\n%s", err, stderr)
+	}
+	if _, stderr, err := tmp.RunGoIn("nested", "build", "./..."); err != nil {
+		t.Errorf("nested module doesn't build: %v\n%s", err, stderr)
+	}
+
+	gopath, err := NewTemporaryWithFiles("fakegopath", nil)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer gopath.Reset()
+	if err := gopath.AddNestedModule("nested", "example.com/nested", ""); err == nil {
+		t.Error("AddNestedModule succeeded for a GOPATH-style tree")
+	}
+}
+
+func TestPackageDir(t *testing.T) {
+	mod, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "", mapToSourceFiles(map[string][]byte{
+		"a/a.go":           []byte("package a\n"),
+		"nested/n/n.go":    []byte("package n\n"),
+		"nested/nested.go": []byte("package nested\n"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer mod.Reset()
+	if err := mod.AddNestedModule("nested", "example.com/m/nested", ""); err != nil {
+		t.Fatal(err)
+	}
+	gopath, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"x/y/y.go": []byte("package y\n")})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer gopath.Reset()
+	for _, c := range []struct {
+		tmp        *Temporary
+		importPath string
+		dir        string
+	}{
+		{mod, "example.com/m", ""},
+		{mod, "example.com/m/a", "a"},
+		{mod, "example.com/m/nested", "nested"},
+		{mod, "example.com/m/nested/n", "nested/n"},
+		{gopath, "x/y", "x/y"},
+	} {
+		dir, err := c.tmp.PackageDir(c.importPath)
+		if err != nil {
+			t.Errorf("PackageDir(%s) failed: %v", c.importPath, err)
+			continue
+		}
+		if want := filepath.Join(c.tmp.Src, filepath.FromSlash(c.dir)); dir != want {
+			t.Errorf("PackageDir(%s) = %s, want %s", c.importPath, dir, want)
+		}
+		if got := c.tmp.ImportPath(c.dir); got != c.importPath {
+			t.Errorf("ImportPath(%q) = %s, want %s", c.dir, got, c.importPath)
+		}
+	}
+	for _, importPath := range []string{"example.com/other", "example.com/mm", "example.com/m/missing"} {
+		if dir, err := mod.PackageDir(importPath); err == nil {
+			t.Errorf("PackageDir(%s) = %s, want an error", importPath, dir)
+		}
+	}
+}
+
+func TestImportModuleVersion(t *testing.T) {
+	proxy := t.TempDir()
+	err := WriteProxyModule(proxy, "example.com/dep", "v1.1.0", map[string][]byte{
+		"dep.go": []byte("package dep\n\nconst Version = \"v1.1.0\"\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"app/main.go": []byte("package main\n\nimport \"example.com/dep\"\n\nfunc main() { println(dep.Version) }\n"),
+	}, WithModuleProxy(proxy), WithSharedModCache(modCache(t)))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.ImportModuleVersion("example.com/dep", "v1.1.0", "example.com/dep"); err != nil {
+		t.Fatalf("ImportModuleVersion failed: %v", err)
+	}
+	tmp.AssertFileMatches(t, "example.com/dep/dep.go", `Version = "v1.1.0"`)
+	if _, stderr, err := tmp.RunGo("vet", "app"); err != nil {
+		t.Errorf("tree doesn't build against the imported module: %v\n%s", err, stderr)
+	}
+	if log := tmp.goLog.String(); !strings.Contains(log, "$ go mod download -json example.com/dep@v1.1.0") {
+		t.Errorf("download not in the go command log:\n%s", log)
+	}
+	if err := tmp.ImportModuleVersion("example.com/dep", "v9.9.9", "missing"); err == nil {
+		t.Error("importing a missing version succeeded")
+	}
+}
@@ -0,0 +1,45 @@
+package fakegopath
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Provider supplies the contents of files on demand, e.g. from a remote blob store.
+// path is slash separated and relative to the src directory.
+type Provider interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+// WithProvider backs the tree with p. Files missing from the tree are fetched from p by Open
+// the first time they are read, rather than being materialised up front.
+func WithProvider(p Provider) Option {
+	return func(t *Temporary) error {
+		t.provider = p
+		return nil
+	}
+}
+
+// Open opens file, a path relative to the src directory, for reading.
+// If file does not exist and the tree has a Provider, it is fetched and written into the tree first.
+func (t *Temporary) Open(file string) (io.ReadCloser, error) {
+	fullPath := filepath.Join(t.Src, file)
+	f, err := os.Open(fullPath)
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) || t.provider == nil {
+		return nil, err
+	}
+	r, err := t.provider.Open(filepath.ToSlash(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", file, err)
+	}
+	defer loggedClose(file, r)
+	if err := t.WriteFile(file, r); err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
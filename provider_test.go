@@ -0,0 +1,53 @@
+package fakegopath
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// countingProvider serves files from a map, counting how often each is opened.
+type countingProvider struct {
+	files map[string]string
+	opens map[string]int
+}
+
+func (p *countingProvider) Open(path string) (io.ReadCloser, error) {
+	p.opens[path]++
+	c, ok := p.files[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(strings.NewReader(c)), nil
+}
+
+func TestProvider(t *testing.T) {
+	p := &countingProvider{files: map[string]string{"p/p.go": "package p\n", "q/q.go": "package q\n"}, opens: map[string]int{}}
+	tmp, err := NewTemporaryWithFiles("fakegopath", nil, WithProvider(p))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if len(p.opens) != 0 {
+		t.Fatalf("files were fetched before being read: %v", p.opens)
+	}
+	for i := 0; i < 2; i++ {
+		r, err := tmp.Open("p/p.go")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(b) != "package p\n" {
+			t.Errorf("read %q, %v, want package p", b, err)
+		}
+	}
+	if want := map[string]int{"p/p.go": 1}; len(p.opens) != 1 || p.opens["p/p.go"] != 1 {
+		t.Errorf("provider opens = %v, want %v", p.opens, want)
+	}
+	if _, err := tmp.Open("missing.go"); err == nil {
+		t.Error("Open of a file the provider doesn't have succeeded")
+	}
+}
@@ -0,0 +1,147 @@
+package fakegopath
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// WithModuleProxy sets GOPROXY in Env to the file-based module proxy in dir, and turns off the checksum
+// database, so that modules resolve offline. Modules can be added to dir with WriteProxyModule.
+// The variables are cleared on Reset.
+func WithModuleProxy(dir string) Option {
+	return func(t *Temporary) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %v", dir, err)
+		}
+		t.setVar("GOPROXY", "file://"+filepath.ToSlash(abs))
+		t.setVar("GOSUMDB", "off")
+		return nil
+	}
+}
+
+// WithSharedModCache sets GOMODCACHE in Env to dir, so that trees using the same dir share downloaded modules.
+// The cache is not removed on Reset. The go tool locks the cache while using it, so trees may share it
+// concurrently, but it must not be cleaned (e.g. with go clean -modcache) while other trees are using it.
+// Files in the cache are read-only, so removing it requires making them writable first.
+func WithSharedModCache(dir string) Option {
+	return func(t *Temporary) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %v", dir, err)
+		}
+		t.setVar("GOMODCACHE", abs)
+		return nil
+	}
+}
+
+// WriteProxyModule adds version of the module modulePath, containing files keyed by slash separated
+// path relative to the module root, to the file-based module proxy in proxyDir.
+// If files has no go.mod, a minimal one is created.
+func WriteProxyModule(proxyDir, modulePath, version string, files map[string][]byte) error {
+	escPath, err := escapeModulePath(modulePath)
+	if err != nil {
+		return err
+	}
+	escVersion, err := escapeModulePath(version)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(proxyDir, filepath.FromSlash(escPath), "@v")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	mod, ok := files["go.mod"]
+	if !ok {
+		mod = []byte(fmt.Sprintf("module %s\n", modulePath))
+		files = copyFileMap(files)
+		files["go.mod"] = mod
+	}
+	zipped, err := zipModule(modulePath, version, files)
+	if err != nil {
+		return err
+	}
+	outputs := map[string][]byte{
+		escVersion + ".info": []byte(fmt.Sprintf(`{"Version":%q}`, version)),
+		escVersion + ".mod":  mod,
+		escVersion + ".zip":  zipped,
+	}
+	for name, contents := range outputs {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, contents, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %v", file, err)
+		}
+	}
+	return addProxyVersion(filepath.Join(dir, "list"), version)
+}
+
+func zipModule(modulePath, version string, files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := bytes.NewBuffer([]byte{})
+	zw := zip.NewWriter(buf)
+	for _, name := range names {
+		w, err := zw.Create(modulePath + "@" + version + "/" + name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to zip: %v", name, err)
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return nil, fmt.Errorf("failed to add %s to zip: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create zip for %s@%s: %v", modulePath, version, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func addProxyVersion(list, version string) error {
+	b, err := ioutil.ReadFile(list)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", list, err)
+	}
+	for _, v := range strings.Fields(string(b)) {
+		if v == version {
+			return nil
+		}
+	}
+	if err := ioutil.WriteFile(list, append(b, version+"\n"...), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", list, err)
+	}
+	return nil
+}
+
+// escapeModulePath applies the module proxy case encoding, replacing upper case letters with '!' and the lower case letter.
+func escapeModulePath(p string) (string, error) {
+	var sb strings.Builder
+	for _, r := range p {
+		switch {
+		case r == '!' || r >= unicode.MaxASCII:
+			return "", fmt.Errorf("invalid character %q in %q", r, p)
+		case 'A' <= r && r <= 'Z':
+			sb.WriteByte('!')
+			sb.WriteRune(unicode.ToLower(r))
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), nil
+}
+
+func copyFileMap(files map[string][]byte) map[string][]byte {
+	res := make(map[string][]byte, len(files)+1)
+	for k, v := range files {
+		res[k] = v
+	}
+	return res
+}
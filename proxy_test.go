@@ -0,0 +1,76 @@
+package fakegopath
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// modCache returns a temporary module cache which is removed after the test.
+func modCache(t *testing.T) string {
+	dir := t.TempDir()
+	// Cleanups run last added first, so the cache is made writable before t.TempDir removes it.
+	t.Cleanup(func() { logError("failed to make "+dir+" writable", setWritable(dir, true)) })
+	return dir
+}
+
+func TestWriteProxyModule(t *testing.T) {
+	proxy := t.TempDir()
+	err := WriteProxyModule(proxy, "example.com/Dep", "v1.2.0", map[string][]byte{
+		"dep.go": []byte("package dep\n\nconst Version = \"v1.2.0\"\n"),
+	})
+	if err != nil {
+		t.Fatalf("WriteProxyModule failed: %v", err)
+	}
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "1.16", mapToSourceFiles(map[string][]byte{
+		"main.go": []byte("package main\n\nimport \"example.com/Dep\"\n\nfunc main() { println(dep.Version) }\n"),
+	}), WithModuleProxy(proxy), WithSharedModCache(modCache(t)))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if _, stderr, err := tmp.RunGo("mod", "tidy"); err != nil {
+		t.Fatalf("go mod tidy failed: %v\n%s", err, stderr)
+	}
+	tmp.AssertRequires(t, "example.com/Dep", "v1.2.0")
+	if _, stderr, err := tmp.RunGo("build", "./..."); err != nil {
+		t.Errorf("tree doesn't build against the proxied module: %v\n%s", err, stderr)
+	}
+	if err := WriteProxyModule(proxy, "example.com/bad!", "v1.0.0", nil); err == nil {
+		t.Error("WriteProxyModule accepted an invalid module path")
+	}
+}
+
+func TestWithSharedModCache(t *testing.T) {
+	proxy, cache := t.TempDir(), modCache(t)
+	if err := WriteProxyModule(proxy, "example.com/dep", "v1.0.0", map[string][]byte{"dep.go": []byte("package dep\n")}); err != nil {
+		t.Fatal(err)
+	}
+	files := mapToSourceFiles(map[string][]byte{
+		"main.go": []byte("package main\n\nimport _ \"example.com/dep\"\n\nfunc main() {}\n"),
+	})
+	first, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/first", "1.16", files, WithModuleProxy(proxy), WithSharedModCache(cache))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer first.Reset()
+	if _, stderr, err := first.RunGo("mod", "tidy"); err != nil {
+		t.Fatalf("go mod tidy failed: %v\n%s", err, stderr)
+	}
+	// With the proxy off, the second tree can only resolve the module from the cache filled by the first.
+	second, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/second", "1.16", files, WithSharedModCache(cache))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer second.Reset()
+	second.setVar("GOPROXY", "off")
+	if err := second.WriteFile("go.mod", strings.NewReader("module example.com/second\n\ngo 1.16\n\nrequire example.com/dep v1.0.0\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.CopyFile("go.sum", filepath.Join(first.Src, "go.sum")); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := second.RunGo("build", "./..."); err != nil {
+		t.Errorf("tree doesn't build from the shared cache: %v\n%s", err, stderr)
+	}
+}
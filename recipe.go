@@ -0,0 +1,65 @@
+package fakegopath
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// Recipe is an ordered list of operations that can be applied to any Temporary.
+// It allows the contents of a tree to be described once and built in many tests.
+type Recipe struct {
+	ops []recipeOp
+}
+
+type recipeOp interface {
+	apply(t *Temporary) error
+}
+
+type writeOp struct {
+	file     string
+	contents []byte
+}
+
+func (o writeOp) apply(t *Temporary) error { return t.WriteFile(o.file, bytes.NewReader(o.contents)) }
+
+type copyOp struct {
+	dest, src string
+}
+
+func (o copyOp) apply(t *Temporary) error { return t.CopyFile(o.dest, o.src) }
+
+type generateOp struct {
+	file string
+	tpl  *template.Template
+	args interface{}
+}
+
+func (o generateOp) apply(t *Temporary) error { return t.GenerateFile(o.file, o.tpl, o.args) }
+
+// WriteFile records a call to Temporary.WriteFile with contents.
+func (r *Recipe) WriteFile(file string, contents []byte) *Recipe {
+	r.ops = append(r.ops, writeOp{file: file, contents: contents})
+	return r
+}
+
+// CopyFile records a call to Temporary.CopyFile.
+func (r *Recipe) CopyFile(dest, src string) *Recipe {
+	r.ops = append(r.ops, copyOp{dest: dest, src: src})
+	return r
+}
+
+// GenerateFile records a call to Temporary.GenerateFile.
+func (r *Recipe) GenerateFile(file string, tpl *template.Template, args interface{}) *Recipe {
+	r.ops = append(r.ops, generateOp{file: file, tpl: tpl, args: args})
+	return r
+}
+
+// Apply performs the recorded operations on t in order, stopping at the first error.
+func (r *Recipe) Apply(t *Temporary) error {
+	for _, op := range r.ops {
+		if err := op.apply(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
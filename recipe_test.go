@@ -0,0 +1,37 @@
+package fakegopath
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+func TestRecipe(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "c.go")
+	if err := ioutil.WriteFile(src, []byte("package c\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := (&Recipe{}).
+		WriteFile(filepath.Join("a", "a.go"), []byte("package a\n")).
+		CopyFile(filepath.Join("c", "c.go"), src).
+		GenerateFile(filepath.Join("g", "g.go"), template.Must(template.New("").Parse("package {{.}}\n")), "g").
+		WriteFile(filepath.Join("a", "a.go"), []byte("package a // rewritten\n"))
+
+	var trees []*Temporary
+	for i := 0; i < 2; i++ {
+		tmp, err := NewTemporaryWithFiles("fakegopath", nil)
+		if err != nil {
+			t.Fatalf("failed to create tree: %v", err)
+		}
+		defer tmp.Reset()
+		if err := r.Apply(tmp); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		trees = append(trees, tmp)
+	}
+	AssertTreesEqual(t, trees[0], trees[1])
+	trees[0].AssertFileEquals(t, filepath.Join("a", "a.go"), []byte("package a // rewritten\n"))
+	trees[0].AssertFileEquals(t, filepath.Join("c", "c.go"), []byte("package c\n"))
+	trees[0].AssertFileEquals(t, filepath.Join("g", "g.go"), []byte("package g\n"))
+}
@@ -0,0 +1,60 @@
+package fakegopath
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ReproducerEnv is the environment variable that enables SaveReproducer.
+const ReproducerEnv = "FAKEGOPATH_REPRODUCER"
+
+// SaveReproducer writes a self-contained bundle for reproducing a failure into dir, if tb has failed
+// and ReproducerEnv is set to a non-empty value. The bundle holds a copy of the src directory in src,
+// the Go related variables from Env and those set for the tree in env.txt, and the output of every go
+// command run against the tree in go.log. Other variables are left out, since they may hold secrets.
+func (t *Temporary) SaveReproducer(tb testing.TB, dir string) {
+	tb.Helper()
+	if !tb.Failed() || os.Getenv(ReproducerEnv) == "" {
+		return
+	}
+	if err := t.saveReproducer(dir); err != nil {
+		tb.Errorf("failed to save reproducer: %v", err)
+		return
+	}
+	tb.Logf("saved reproducer to %s", dir)
+}
+
+func (t *Temporary) saveReproducer(dir string) error {
+	files, err := t.ToMap()
+	if err != nil {
+		return err
+	}
+	var env []string
+	for _, e := range t.Env() {
+		key := strings.SplitN(e, "=", 2)[0]
+		if _, ok := t.vars[key]; ok || isGoVar(key) || (key == "PATH" && len(t.path) > 0) {
+			env = append(env, e)
+		}
+	}
+	bundle := map[string][]byte{
+		"env.txt": []byte(strings.Join(env, "\n") + "\n"),
+		"go.log":  []byte(t.goLog.String()),
+	}
+	for p, c := range files {
+		bundle["src/"+p] = c
+	}
+	for p, c := range bundle {
+		file := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return fmt.Errorf("failed to create dir %s: %v", filepath.Dir(file), err)
+		}
+		if err := ioutil.WriteFile(file, c, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %v", file, err)
+		}
+	}
+	return nil
+}
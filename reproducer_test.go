@@ -0,0 +1,65 @@
+package fakegopath
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveReproducer(t *testing.T) {
+	t.Setenv("FAKEGOPATH_TEST_TOKEN", "secret-token")
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"p/p.go": []byte("package p\n")})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if _, stderr, err := tmp.RunGo("list", "p"); err != nil {
+		t.Fatalf("go list failed: %v\n%s", err, stderr)
+	}
+	if err := tmp.StreamGo([]string{"env", "GO111MODULE"}, func(string) {}); err != nil {
+		t.Fatalf("go env failed: %v", err)
+	}
+
+	passed := filepath.Join(t.TempDir(), "passed")
+	t.Setenv(ReproducerEnv, "1")
+	tmp.SaveReproducer(&recordingTB{}, passed)
+	if _, err := os.Stat(passed); !os.IsNotExist(err) {
+		t.Errorf("reproducer saved for a passing test: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "repro")
+	r := record(func(tb testing.TB) {
+		tb.Errorf("simulated failure")
+		tmp.SaveReproducer(tb, dir)
+	})
+	if len(r.msgs) != 1 {
+		t.Fatalf("SaveReproducer failed: %s", r)
+	}
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("bundle is missing %s: %v", name, err)
+		}
+		return string(b)
+	}
+	if got := read("src/p/p.go"); got != "package p\n" {
+		t.Errorf("src/p/p.go = %q, want package p", got)
+	}
+	env := read("env.txt")
+	for _, want := range []string{"GOPATH=" + tmp.goPath(), "GO111MODULE=off"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("env.txt is missing %s:\n%s", want, env)
+		}
+	}
+	if strings.Contains(env, "secret-token") {
+		t.Errorf("env.txt contains unrelated variables:\n%s", env)
+	}
+	log := read("go.log")
+	for _, want := range []string{"$ go list p\np\n", "$ go env GO111MODULE\noff\n"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("go.log is missing %q:\n%s", want, log)
+		}
+	}
+}
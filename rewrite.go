@@ -0,0 +1,94 @@
+package fakegopath
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// WithPackageRewrite makes CopyFile and CopyDir rewrite the package clause of copied .go files to match
+// the name of the destination directory. External test packages keep their _test suffix and
+// main packages are left alone. Only the package clause is changed.
+func WithPackageRewrite(enable bool) Option {
+	return func(t *Temporary) error {
+		t.rewritePkg = enable
+		return nil
+	}
+}
+
+// packageName returns the package name for .go files copied to dest: the name of the destination directory,
+// or the last element of the module path for the root of a module. It returns false if there is no such name,
+// e.g. for the root of a GOPATH-style tree, in which case the package clause is left alone.
+func (t *Temporary) packageName(dest string) (string, bool) {
+	rel := filepath.ToSlash(filepath.Dir(filepath.Clean(dest)))
+	if rel == "." {
+		rel = ""
+	}
+	name := path.Base(rel)
+	if t.IsModule() {
+		if root, module := t.moduleFor(rel); root == rel {
+			name = path.Base(module)
+		}
+	}
+	return name, token.IsIdentifier(name)
+}
+
+// rewritePackage returns src, the contents of dest, with its package clause changed to name.
+func rewritePackage(name, dest string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, dest, src, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", dest, err)
+	}
+	old := f.Name.Name
+	if strings.HasSuffix(old, "_test") {
+		name += "_test"
+	}
+	if old == "main" || old == name {
+		return src, nil
+	}
+	off := fset.Position(f.Name.Pos()).Offset
+	return bytes.Join([][]byte{src[:off], []byte(name), src[off+len(old):]}, nil), nil
+}
+
+func (t *Temporary) copyRewritten(dest, src string, dirs dirCache) error {
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", src, err)
+	}
+	if name, ok := t.packageName(dest); ok {
+		if b, err = rewritePackage(name, dest, b); err != nil {
+			return err
+		}
+	}
+	return t.writeFile(dest, bytes.NewReader(b), dirs)
+}
+
+// WithForceCRLF makes WriteFile and the functions built on it write text files with CRLF line endings.
+// Files that look binary, containing NUL bytes or invalid UTF-8, are written unchanged.
+func WithForceCRLF(enable bool) Option {
+	return func(t *Temporary) error {
+		t.crlf = enable
+		return nil
+	}
+}
+
+// toCRLF returns contents with LF line endings replaced by CRLF if contents is text.
+func toCRLF(contents io.Reader) (io.Reader, error) {
+	b, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(b, 0) >= 0 || !utf8.Valid(b) {
+		return bytes.NewReader(b), nil
+	}
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.NewReader(bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))), nil
+}
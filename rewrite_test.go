@@ -0,0 +1,87 @@
+package fakegopath
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWithPackageRewrite(t *testing.T) {
+	src := writeDir(t, map[string]string{
+		"a/a.go":       "// Package a is moved.\npackage a\n\nconst A = 1\n",
+		"a/a_test.go":  "package a_test\n",
+		"main/main.go": "package main\n\nfunc main() {}\n",
+	})
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"b/b.go": []byte("package b\n\nconst B = A\n"),
+	}, WithPackageRewrite(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.CopyDir("b", filepath.Join(src, "a")); err != nil {
+		t.Fatalf("CopyDir failed: %v", err)
+	}
+	if err := tmp.CopyFile(filepath.Join("app", "main.go"), filepath.Join(src, "main", "main.go")); err != nil {
+		t.Fatalf("CopyFile failed: %v", err)
+	}
+	// The root of a GOPATH-style tree has no package name, so the clause is left alone.
+	if err := tmp.CopyFile("root.go", filepath.Join(src, "a", "a.go")); err != nil {
+		t.Fatalf("CopyFile to the root failed: %v", err)
+	}
+	tmp.AssertFileEquals(t, filepath.Join("b", "a.go"), []byte("// Package a is moved.\npackage b\n\nconst A = 1\n"))
+	tmp.AssertFileEquals(t, filepath.Join("b", "a_test.go"), []byte("package b_test\n"))
+	tmp.AssertFileEquals(t, filepath.Join("app", "main.go"), []byte("package main\n\nfunc main() {}\n"))
+	tmp.AssertFileMatches(t, "root.go", "\npackage a\n")
+	if _, stderr, err := tmp.RunGo("build", "b", "app"); err != nil {
+		t.Errorf("moved files don't compile: %v\n%s", err, stderr)
+	}
+}
+
+func TestWithPackageRewriteModuleRoot(t *testing.T) {
+	src := writeDir(t, map[string]string{"a.go": "package a\n"})
+	tmp, err := NewTemporaryModuleWithFiles("fakegopath", "example.com/m", "1.16", nil, WithPackageRewrite(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	if err := tmp.AddNestedModule("nested", "example.com/other", "1.16"); err != nil {
+		t.Fatalf("AddNestedModule failed: %v", err)
+	}
+	if err := tmp.CopyFile("m.go", filepath.Join(src, "a.go")); err != nil {
+		t.Fatalf("CopyFile to the module root failed: %v", err)
+	}
+	if err := tmp.CopyFile(filepath.Join("nested", "other.go"), filepath.Join(src, "a.go")); err != nil {
+		t.Fatalf("CopyFile to the nested module root failed: %v", err)
+	}
+	tmp.AssertFileEquals(t, "m.go", []byte("package m\n"))
+	tmp.AssertFileEquals(t, filepath.Join("nested", "other.go"), []byte("package other\n"))
+	if _, stderr, err := tmp.RunGo("build", "./..."); err != nil {
+		t.Errorf("tree doesn't compile: %v\n%s", err, stderr)
+	}
+}
+
+func TestWithForceCRLF(t *testing.T) {
+	binary := []byte("a\n\x00b\n")
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"text.txt":   []byte("a\nb\r\nc"),
+		"binary.bin": binary,
+	}, WithForceCRLF(true))
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	tmp.AssertFileEquals(t, "text.txt", []byte("a\r\nb\r\nc"))
+	tmp.AssertFileEquals(t, "binary.bin", binary)
+
+	// WriteFileIfChanged compares the converted contents with the file.
+	if changed, err := tmp.WriteFileIfChanged("text.txt", []byte("a\nb\nc")); err != nil || changed {
+		t.Errorf("WriteFileIfChanged with the same text = %v, %v, want false, nil", changed, err)
+	}
+	if changed, err := tmp.WriteFileIfChanged("text.txt", []byte("a\nd\n")); err != nil || !changed {
+		t.Errorf("WriteFileIfChanged with new text = %v, %v, want true, nil", changed, err)
+	}
+	tmp.AssertFileEquals(t, "text.txt", []byte("a\r\nd\r\n"))
+	if changed, err := tmp.WriteFileIfChanged("binary.bin", binary); err != nil || changed {
+		t.Errorf("WriteFileIfChanged with the same binary = %v, %v, want false, nil", changed, err)
+	}
+}
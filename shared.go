@@ -0,0 +1,87 @@
+package fakegopath
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// shared holds the trees created by FreezeShared, keyed by name.
+var shared struct {
+	sync.Mutex
+	trees map[string]*sharedTree
+}
+
+type sharedTree struct {
+	once sync.Once
+	t    *Temporary
+	err  error
+}
+
+// FreezeShared returns a read-only tree shared by every caller using key. The first caller creates the tree,
+// which does not update GOPATH, and fills it with build; later callers wait for it and get the same tree.
+// Reset is a no-op on shared trees. They are removed by ResetShared, typically called from TestMain.
+func FreezeShared(key string, build func(*Temporary) error) (*Temporary, error) {
+	shared.Lock()
+	if shared.trees == nil {
+		shared.trees = map[string]*sharedTree{}
+	}
+	s, ok := shared.trees[key]
+	if !ok {
+		s = &sharedTree{}
+		shared.trees[key] = s
+	}
+	shared.Unlock()
+	s.once.Do(func() { s.t, s.err = newShared(build) })
+	return s.t, s.err
+}
+
+// ResetShared removes all trees created by FreezeShared.
+func ResetShared() {
+	shared.Lock()
+	trees := shared.trees
+	shared.trees = nil
+	shared.Unlock()
+	for _, s := range trees {
+		if s.t == nil {
+			continue
+		}
+		logError("failed to make "+s.t.Path+" writable", setWritable(s.t.Path, true))
+		s.t.shared = false
+		s.t.Reset()
+	}
+}
+
+func newShared(build func(*Temporary) error) (*Temporary, error) {
+	t, err := newTemporaryWithFiles("fakegopath-shared", nil, func(dir string) (*Temporary, error) {
+		return NewTemporary(dir, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := build(t); err != nil {
+		t.Reset()
+		return nil, fmt.Errorf("failed to build shared tree: %v", err)
+	}
+	if err := setWritable(t.Path, false); err != nil {
+		t.Reset()
+		return nil, fmt.Errorf("failed to freeze shared tree: %v", err)
+	}
+	t.shared = true
+	return t, nil
+}
+
+// setWritable adds or removes write permission from everything under root.
+func setWritable(root string, writable bool) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		mode := info.Mode().Perm() &^ 0222
+		if writable {
+			mode |= 0200
+		}
+		return os.Chmod(path, mode)
+	})
+}
@@ -0,0 +1,72 @@
+package fakegopath
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFreezeShared(t *testing.T) {
+	var builds int32
+	build := func(tmp *Temporary) error {
+		atomic.AddInt32(&builds, 1)
+		return tmp.WriteFile(filepath.Join("p", "p.go"), strings.NewReader("package p\n"))
+	}
+	trees := make([]*Temporary, 2)
+	t.Run("consumers", func(t *testing.T) {
+		for i := range trees {
+			i := i
+			t.Run("", func(t *testing.T) {
+				t.Parallel()
+				tmp, err := FreezeShared("TestFreezeShared", build)
+				if err != nil {
+					t.Fatalf("FreezeShared failed: %v", err)
+				}
+				if _, stderr, err := tmp.RunGo("list", "p"); err != nil {
+					t.Errorf("go list failed: %v\n%s", err, stderr)
+				}
+				tmp.Reset()
+				trees[i] = tmp
+			})
+		}
+	})
+	if builds != 1 {
+		t.Errorf("tree was built %d times, want once", builds)
+	}
+	if trees[0] == nil || trees[0] != trees[1] {
+		t.Fatalf("consumers got different trees %p and %p", trees[0], trees[1])
+	}
+	tmp := trees[0]
+	if _, err := os.Stat(filepath.Join(tmp.Src, "p", "p.go")); err != nil {
+		t.Errorf("Reset removed the shared tree: %v", err)
+	}
+	if err := tmp.Configure(WithDeterministicBuild()); err == nil {
+		t.Error("Configure of a shared tree succeeded")
+	}
+	if err := tmp.StubGo("#!/bin/sh\n"); err == nil {
+		t.Error("StubGo in a shared tree succeeded")
+	}
+	if log := tmp.goLog.String(); strings.Count(log, "$ go list p") != 2 {
+		t.Errorf("go.log doesn't have both commands:\n%s", log)
+	}
+}
+
+func TestResetShared(t *testing.T) {
+	tmp, err := FreezeShared("TestResetShared", func(*Temporary) error { return nil })
+	if err != nil {
+		t.Fatalf("FreezeShared failed: %v", err)
+	}
+	ResetShared()
+	if _, err := os.Stat(tmp.Path); !os.IsNotExist(err) {
+		t.Errorf("ResetShared didn't remove %s: %v", tmp.Path, err)
+	}
+	again, err := FreezeShared("TestResetShared", func(*Temporary) error { return nil })
+	if err != nil {
+		t.Fatalf("FreezeShared failed: %v", err)
+	}
+	if again == tmp {
+		t.Error("FreezeShared returned a tree removed by ResetShared")
+	}
+}
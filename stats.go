@@ -0,0 +1,50 @@
+package fakegopath
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// CodeStats summarises the Go code in a tree.
+type CodeStats struct {
+	Packages int // The number of distinct packages, counting external test packages separately.
+	Files    int // The number of .go files.
+	Lines    int // The number of non-blank lines in .go files.
+}
+
+// CodeStats returns statistics about the .go files in the src directory.
+func (t *Temporary) CodeStats() (CodeStats, error) {
+	var stats CodeStats
+	pkgs := map[string]bool{}
+	fset := token.NewFileSet()
+	err := walkFiles(t.Src, func(rel string, _ os.FileInfo) error {
+		if path.Ext(rel) != ".go" {
+			return nil
+		}
+		file := filepath.Join(t.Src, filepath.FromSlash(rel))
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		f, err := parser.ParseFile(fset, file, src, parser.PackageClauseOnly)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", file, err)
+		}
+		pkgs[path.Dir(rel)+" "+f.Name.Name] = true
+		stats.Files++
+		for _, l := range bytes.Split(src, []byte("\n")) {
+			if len(bytes.TrimSpace(l)) > 0 {
+				stats.Lines++
+			}
+		}
+		return nil
+	})
+	stats.Packages = len(pkgs)
+	return stats, err
+}
@@ -0,0 +1,26 @@
+package fakegopath
+
+import (
+	"testing"
+)
+
+func TestCodeStats(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"a/a.go":      []byte("package a\n\n// A is one.\nconst A = 1\n"),
+		"a/b.go":      []byte("package a\n\n\nconst B = 2\n"),
+		"a/a_test.go": []byte("package a_test\n"),
+		"c/c.go":      []byte("package c\n"),
+		"c/README":    []byte("not go\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	stats, err := tmp.CodeStats()
+	if err != nil {
+		t.Fatalf("CodeStats failed: %v", err)
+	}
+	if want := (CodeStats{Packages: 3, Files: 4, Lines: 7}); stats != want {
+		t.Errorf("CodeStats = %+v, want %+v", stats, want)
+	}
+}
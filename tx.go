@@ -0,0 +1,148 @@
+package fakegopath
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// Tx stages writes to a tree, which are applied together if the transaction succeeds. See Transaction.
+type Tx struct {
+	staging *Temporary // A copy of the tree whose src directory is the staging directory.
+	files   []string   // The staged files, in the order they were first written.
+	seen    map[string]bool
+}
+
+// WriteFile stages a call to Temporary.WriteFile.
+func (tx *Tx) WriteFile(file string, contents io.Reader) error {
+	if err := tx.staging.WriteFile(file, contents); err != nil {
+		return err
+	}
+	tx.add(file)
+	return nil
+}
+
+// CopyFile stages a call to Temporary.CopyFile.
+func (tx *Tx) CopyFile(dest, src string) error {
+	if err := tx.staging.CopyFile(dest, src); err != nil {
+		return err
+	}
+	tx.add(dest)
+	return nil
+}
+
+// GenerateFile stages a call to Temporary.GenerateFile.
+func (tx *Tx) GenerateFile(file string, tpl *template.Template, args interface{}) error {
+	if err := tx.staging.GenerateFile(file, tpl, args); err != nil {
+		return err
+	}
+	tx.add(file)
+	return nil
+}
+
+func (tx *Tx) add(file string) {
+	file = filepath.Clean(file)
+	if !tx.seen[file] {
+		tx.seen[file] = true
+		tx.files = append(tx.files, file)
+	}
+}
+
+// Transaction runs fn with a Tx whose writes are staged in a temporary directory. If fn succeeds, the staged
+// files are renamed into the tree. If fn fails, they are discarded and the tree is unchanged. If renaming
+// fails, e.g. with ErrQuotaExceeded, the files already renamed are removed and the files they replaced restored.
+func (t *Temporary) Transaction(fn func(tx *Tx) error) error {
+	// The staging directory is in the tree so that renames stay on one file system. Its name starts with
+	// a dot so that the go tool ignores it for module-style trees.
+	dir, err := ioutil.TempDir(t.Path, ".tx")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	defer func() { logError("failed to remove "+dir, os.RemoveAll(dir)) }()
+	staging := *t
+	// Staged files are counted towards WithMaxTotalSize when they are committed.
+	staging.Src, staging.maxTotal = dir, 0
+	tx := &Tx{staging: &staging, seen: map[string]bool{}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	backup, err := ioutil.TempDir(t.Path, ".txbackup")
+	if err != nil {
+		return fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	defer func() { logError("failed to remove "+backup, os.RemoveAll(backup)) }()
+	return tx.commit(t, backup)
+}
+
+// commit renames the staged files into t, first moving the files they replace into backup.
+// If a file can't be committed, the tree is rolled back.
+func (tx *Tx) commit(t *Temporary, backup string) error {
+	used := t.used
+	var committed, created []string // Committed files, and the topmost directories created for them.
+	backedUp := map[string]bool{}
+	restore := func(f string) {
+		logError("failed to restore "+f, os.Rename(filepath.Join(backup, f), filepath.Join(t.Src, f)))
+	}
+	rollback := func() {
+		for i := len(committed) - 1; i >= 0; i-- {
+			f := committed[i]
+			logError("failed to roll back "+f, os.Remove(filepath.Join(t.Src, f)))
+			if backedUp[f] {
+				restore(f)
+			}
+		}
+		for i := len(created) - 1; i >= 0; i-- {
+			logError("failed to roll back "+created[i], os.RemoveAll(created[i]))
+		}
+		t.used = used
+	}
+	for _, f := range tx.files {
+		dest, src := filepath.Join(t.Src, f), filepath.Join(tx.staging.Src, f)
+		if top := missingAncestor(filepath.Dir(dest)); top != "" {
+			if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+				rollback()
+				return fmt.Errorf("failed to create dir %s: %v", filepath.Dir(dest), err)
+			}
+			created = append(created, top)
+		}
+		if err := t.reserve(fileSize(dest), fileSize(src)); err != nil {
+			rollback()
+			return err
+		}
+		if info, err := os.Lstat(dest); err == nil && !info.IsDir() {
+			b := filepath.Join(backup, f)
+			if err := os.MkdirAll(filepath.Dir(b), 0700); err != nil {
+				rollback()
+				return fmt.Errorf("failed to create dir %s: %v", filepath.Dir(b), err)
+			}
+			if err := os.Rename(dest, b); err != nil {
+				rollback()
+				return fmt.Errorf("failed to back up %s: %v", f, err)
+			}
+			backedUp[f] = true
+		}
+		if err := os.Rename(src, dest); err != nil {
+			if backedUp[f] {
+				restore(f)
+			}
+			rollback()
+			return fmt.Errorf("failed to commit %s: %v", f, err)
+		}
+		committed = append(committed, f)
+	}
+	return nil
+}
+
+// missingAncestor returns the topmost directory in the path to dir that does not exist, or "" if dir exists.
+func missingAncestor(dir string) string {
+	top := ""
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			return top
+		}
+		top = d
+	}
+}
@@ -0,0 +1,106 @@
+package fakegopath
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"p/p.go": []byte("package p\n")})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	err = tmp.Transaction(func(tx *Tx) error {
+		if err := tx.WriteFile("p/p.go", strings.NewReader("package p // new\n")); err != nil {
+			return err
+		}
+		return tx.WriteFile("q/q.go", strings.NewReader("package q\n"))
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	tmp.AssertFileEquals(t, "p/p.go", []byte("package p // new\n"))
+	tmp.AssertFileEquals(t, "q/q.go", []byte("package q\n"))
+	assertOnlyFiles(t, tmp, "p/p.go", "q/q.go")
+}
+
+func TestTransactionFailureWritesNothing(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{"p/p.go": []byte("package p\n")})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	fnErr := errors.New("fn failed")
+	err = tmp.Transaction(func(tx *Tx) error {
+		if err := tx.WriteFile("p/p.go", strings.NewReader("package p // new\n")); err != nil {
+			return err
+		}
+		if err := tx.WriteFile("q/q.go", strings.NewReader("package q\n")); err != nil {
+			return err
+		}
+		return fnErr
+	})
+	if err != fnErr {
+		t.Fatalf("Transaction returned %v, want the error from fn", err)
+	}
+	tmp.AssertFileEquals(t, "p/p.go", []byte("package p\n"))
+	assertOnlyFiles(t, tmp, "p/p.go")
+	// A failed staged write isn't committed.
+	err = tmp.Transaction(func(tx *Tx) error {
+		_ = tx.CopyFile("missing.go", filepath.Join(tmp.Path, "does-not-exist"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	assertOnlyFiles(t, tmp, "p/p.go")
+}
+
+func TestTransactionRollback(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"a.txt":         []byte("old a\n"),
+		"blocked/x.txt": []byte("x\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	err = tmp.Transaction(func(tx *Tx) error {
+		for _, f := range []string{"a.txt", "new/dir/b.txt", "blocked"} {
+			if err := tx.WriteFile(f, strings.NewReader("new\n")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// blocked is a non-empty directory, so renaming a file over it fails after a.txt and b.txt are committed.
+	if err == nil {
+		t.Fatal("Transaction replaced a directory with a file")
+	}
+	tmp.AssertFileEquals(t, "a.txt", []byte("old a\n"))
+	tmp.AssertFileEquals(t, "blocked/x.txt", []byte("x\n"))
+	assertOnlyFiles(t, tmp, "a.txt", "blocked/x.txt")
+	if _, err := os.Stat(filepath.Join(tmp.Src, "new")); !os.IsNotExist(err) {
+		t.Errorf("directory created by the transaction was left behind: %v", err)
+	}
+}
+
+// assertOnlyFiles fails t unless want are the files in tmp, and nothing was left in its temp dir by transactions.
+func assertOnlyFiles(t *testing.T, tmp *Temporary, want ...string) {
+	t.Helper()
+	files, err := tmp.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Files = %v, want %v", files, want)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tmp.Path, ".tx*")); len(matches) > 0 {
+		t.Errorf("transaction directories left behind: %v", matches)
+	}
+}
@@ -0,0 +1,104 @@
+package fakegopath
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// AssertMatchesTxtar fails tb if the files in the src directory differ from those in the txtar archive at goldenPath.
+// If update is true, the archive is instead rewritten from the tree.
+// As in the txtar format, a missing final newline in a file is not considered a difference.
+func (t *Temporary) AssertMatchesTxtar(tb testing.TB, goldenPath string, update bool) {
+	tb.Helper()
+	files, err := t.ToMap()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if update {
+		if err := ioutil.WriteFile(goldenPath, formatTxtar(files), 0644); err != nil {
+			tb.Fatalf("failed to update %s: %v", goldenPath, err)
+		}
+		return
+	}
+	b, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		tb.Fatalf("failed to read %s: %v", goldenPath, err)
+	}
+	for p, c := range files {
+		files[p] = fixNL(c)
+	}
+	for _, d := range diffFiles(parseTxtar(b), files) {
+		switch d.Kind {
+		case OnlyInA:
+			tb.Errorf("%s: missing from tree", d.Path)
+		case OnlyInB:
+			tb.Errorf("%s: not in %s", d.Path, goldenPath)
+		default:
+			tb.Errorf("%s: differs from %s", d.Path, goldenPath)
+		}
+	}
+}
+
+// formatTxtar returns files as a txtar archive, sorted by path.
+func formatTxtar(files map[string][]byte) []byte {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	buf := bytes.NewBuffer([]byte{})
+	for _, p := range paths {
+		buf.WriteString("-- " + p + " --\n")
+		buf.Write(fixNL(files[p]))
+	}
+	return buf.Bytes()
+}
+
+// parseTxtar returns the files in a txtar archive, ignoring the leading comment.
+func parseTxtar(data []byte) map[string][]byte {
+	files := map[string][]byte{}
+	var name string
+	var content []byte
+	inFile := false
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i+1], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		if n, ok := txtarMarker(line); ok {
+			if inFile {
+				files[name] = content
+			}
+			name, content, inFile = n, []byte{}, true
+			continue
+		}
+		if inFile {
+			content = append(content, line...)
+		}
+	}
+	if inFile {
+		files[name] = fixNL(content)
+	}
+	return files
+}
+
+func txtarMarker(line []byte) (string, bool) {
+	l := strings.TrimRight(string(line), "\r\n")
+	if !strings.HasPrefix(l, "-- ") || !strings.HasSuffix(l, " --") || len(l) < len("-- x --") {
+		return "", false
+	}
+	name := strings.TrimSpace(l[3 : len(l)-3])
+	return name, name != ""
+}
+
+func fixNL(data []byte) []byte {
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return data
+	}
+	return append(append([]byte{}, data...), '\n')
+}
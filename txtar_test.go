@@ -0,0 +1,66 @@
+package fakegopath
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssertMatchesTxtar(t *testing.T) {
+	tmp, err := NewTemporaryFromMap("fakegopath", map[string][]byte{
+		"a/a.go": []byte("package a\n"),
+		"b/b.go": []byte("package b"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	defer tmp.Reset()
+	dir := t.TempDir()
+
+	t.Run("match", func(t *testing.T) {
+		golden := filepath.Join(dir, "match.txtar")
+		archive := "Comments before the first file are ignored.\n-- a/a.go --\npackage a\n-- b/b.go --\npackage b\n"
+		if err := ioutil.WriteFile(golden, []byte(archive), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if r := record(func(tb testing.TB) { tmp.AssertMatchesTxtar(tb, golden, false) }); r.Failed() {
+			t.Errorf("matching archive reported differences: %s", r)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		golden := filepath.Join(dir, "mismatch.txtar")
+		archive := "-- a/a.go --\npackage changed\n-- c/c.go --\npackage c\n"
+		if err := ioutil.WriteFile(golden, []byte(archive), 0600); err != nil {
+			t.Fatal(err)
+		}
+		r := record(func(tb testing.TB) { tmp.AssertMatchesTxtar(tb, golden, false) })
+		want := []string{"a/a.go: differs", "b/b.go: not in", "c/c.go: missing from tree"}
+		if len(r.msgs) != len(want) {
+			t.Fatalf("got failures %q, want %q", r.msgs, want)
+		}
+		for i, w := range want {
+			if !strings.HasPrefix(r.msgs[i], w) {
+				t.Errorf("failure %q, want prefix %q", r.msgs[i], w)
+			}
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		golden := filepath.Join(dir, "update.txtar")
+		if r := record(func(tb testing.TB) { tmp.AssertMatchesTxtar(tb, golden, true) }); r.Failed() {
+			t.Fatalf("update failed: %s", r)
+		}
+		b, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), "-- a/a.go --\npackage a\n-- b/b.go --\npackage b\n"; got != want {
+			t.Errorf("updated archive = %q, want %q", got, want)
+		}
+		if r := record(func(tb testing.TB) { tmp.AssertMatchesTxtar(tb, golden, false) }); r.Failed() {
+			t.Errorf("tree doesn't match the archive it updated: %s", r)
+		}
+	})
+}